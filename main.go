@@ -6,6 +6,10 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
 
 	logger "github.com/kubescape/go-logger"
 	"github.com/kubescape/go-logger/helpers"
@@ -39,52 +43,121 @@ func main() {
 		defer logger.ShutdownOtel(ctx)
 	}
 
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		sig := <-signals
+		logger.L().Ctx(ctx).Info("shutting down", helpers.String("signal", sig.String()))
+		cancel()
+	}()
+
 	wh, err := watch.CreateWatchHandler(config)
 	if err != nil {
 		logger.L().Ctx(ctx).Fatal("failed to initialize the WatchHandler", helpers.Error(err))
 	}
+	wh.CheckPermissions(ctx)
+	wh.RegisterHealthHandler()
+	// the readiness probe passes once the sink is ready and every watcher finished its initial list
+	var sinkReady atomic.Bool
+	go wh.UpdateReadiness(ctx, &sinkReady, &isServerReady)
+
+	if watch.IsLeaderElectionEnabled() {
+		wh.RunAsLeader(ctx, &sinkReady, func(ctx context.Context) {
+			runReporting(ctx, wh, &sinkReady)
+		})
+		return
+	}
+	runReporting(ctx, wh, &sinkReady)
+}
 
+// runReporting starts the watchers and sends their reports until the sink fails or ctx is done. On shutdown the
+// last report and the queued ones are delivered within SHUTDOWN_GRACE_PERIOD
+func runReporting(ctx context.Context, wh *watch.WatchHandler, sinkReady *atomic.Bool) {
+	reportsDone := make(chan struct{})
 	go func() {
-		for {
+		defer close(reportsDone)
+		for ctx.Err() == nil {
 			wh.ListenerAndSender(ctx)
 		}
 	}()
 
-	go func() {
-		for {
-			wh.NodeWatch(ctx)
+	watchers := map[string]func(context.Context){
+		"nodes":                  wh.NodeWatch,
+		"pods":                   wh.PodWatch,
+		"services":               wh.ServiceWatch,
+		"secrets":                wh.SecretWatch,
+		"namespaces":             wh.NamespaceWatch,
+		"cronjobs":               wh.CronJobWatch,
+		"ingresses":              wh.IngressWatch,
+		"ingressclasses":         wh.IngressClassWatch,
+		"networkpolicies":        wh.NetworkPolicyWatch,
+		"roles":                  wh.RoleWatch,
+		"clusterroles":           wh.ClusterRoleWatch,
+		"rolebindings":           wh.RoleBindingWatch,
+		"clusterrolebindings":    wh.ClusterRoleBindingWatch,
+		"serviceaccounts":        wh.ServiceAccountWatch,
+		"persistentvolumes":      wh.PersistentVolumeWatch,
+		"persistentvolumeclaims": wh.PersistentVolumeClaimWatch,
+		"storageclasses":         wh.StorageClassWatch,
+	}
+	for _, gvr := range wh.DynamicResources() {
+		gvr := gvr
+		watchers[gvr.String()] = func(ctx context.Context) {
+			wh.DynamicWatch(ctx, gvr)
 		}
-	}()
-
-	go func() {
-		for {
-			wh.PodWatch(ctx)
+	}
+	watchersDone := sync.WaitGroup{}
+	for resource, watcher := range watchers {
+		if !wh.IsWatcherEnabled(resource) {
+			continue
 		}
-	}()
+		watchersDone.Add(1)
+		go func(watcher func(context.Context)) {
+			defer watchersDone.Done()
+			for ctx.Err() == nil {
+				watcher(ctx)
+			}
+		}(watcher)
+	}
 
+	// the sink outlives ctx so it can deliver the reports queued before the shutdown
+	sinkCtx, stopSink := context.WithCancel(context.Background())
+	defer stopSink()
+	sinkDone := make(chan error, 1)
 	go func() {
-		for {
-			wh.ServiceWatch(ctx)
-		}
+		sinkDone <- wh.Sink.Run(sinkCtx, sinkReady, wh.SetFirstReportFlag)
 	}()
+	select {
+	case err := <-sinkDone:
+		logger.L().Ctx(ctx).Fatal(err.Error())
+	case <-ctx.Done():
+	}
 
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), watch.ShutdownGracePeriod())
+	defer cancelFlush()
+	// the watchers handle the events they still hold before the last report is sent
+	stopped := make(chan struct{})
 	go func() {
-		for {
-			wh.SecretWatch(ctx)
-		}
+		<-reportsDone
+		watchersDone.Wait()
+		close(stopped)
 	}()
-	go func() {
-		for {
-			wh.NamespaceWatch(ctx)
-		}
-	}()
-	go func() {
-		for {
-			wh.CronJobWatch(ctx)
-		}
-	}()
-	logger.L().Ctx(ctx).Fatal(wh.WebSocketHandle.SendReportRoutine(ctx, &isServerReady, wh.SetFirstReportFlag).Error())
-
+	select {
+	case <-stopped:
+		wh.SendPendingReport(flushCtx)
+	case <-flushCtx.Done():
+	}
+	if err := wh.Sink.Flush(flushCtx); err != nil {
+		logger.L().Ctx(flushCtx).Warning("failed to deliver the queued reports before shutting down", helpers.Error(err))
+	}
+	stopSink()
+	select {
+	case <-sinkDone:
+	case <-flushCtx.Done():
+	}
+	logger.L().Info("shutdown complete")
 }
 
 func displayBuildTag() {
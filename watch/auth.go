@@ -0,0 +1,131 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	logger "github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+	"github.com/kubescape/kollector/consts"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	AccessTokenFileEnv      = "ACCESS_TOKEN_FILE"
+	AccessTokenSecretEnv    = "ACCESS_TOKEN_SECRET"
+	AccessTokenSecretKeyEnv = "ACCESS_TOKEN_SECRET_KEY"
+)
+
+const (
+	defaultAccessTokenSecretKey = "token"
+)
+
+// errAuthenticationFailed is returned when the backend rejects the access token
+var errAuthenticationFailed = errors.New("authentication failed")
+
+// tokenSource provides the access token the connections to the backend authenticate with
+type tokenSource interface {
+	token(ctx context.Context) (string, error)
+}
+
+// createTokenSource creates the token source selected by the ACCESS_TOKEN_* environment variables, or nil when
+// the connections are not authenticated
+func createTokenSource(client kubernetes.Interface) tokenSource {
+	if path := os.Getenv(AccessTokenFileEnv); path != "" {
+		logger.L().Info("reading access token from file", helpers.String("path", path))
+		return &fileTokenSource{path: path}
+	}
+	if secret := os.Getenv(AccessTokenSecretEnv); secret != "" {
+		namespace, name, found := strings.Cut(secret, "/")
+		if !found {
+			namespace, name = os.Getenv(consts.NamespaceEnvironmentVariable), secret
+		}
+		key := os.Getenv(AccessTokenSecretKeyEnv)
+		if key == "" {
+			key = defaultAccessTokenSecretKey
+		}
+		logger.L().Info("reading access token from secret", helpers.String("namespace", namespace), helpers.String("name", name), helpers.String("key", key))
+		return &secretTokenSource{client: client, namespace: namespace, name: name, key: key}
+	}
+	return nil
+}
+
+// fileTokenSource reads the token from a mounted file, and reads it again whenever the file is rotated
+type fileTokenSource struct {
+	path    string
+	mutex   sync.Mutex
+	modTime time.Time
+	cached  string
+}
+
+func (source *fileTokenSource) token(ctx context.Context) (string, error) {
+	source.mutex.Lock()
+	defer source.mutex.Unlock()
+
+	info, err := os.Stat(source.path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read access token: %w", err)
+	}
+	if source.cached != "" && info.ModTime().Equal(source.modTime) {
+		return source.cached, nil
+	}
+	data, err := os.ReadFile(source.path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read access token: %w", err)
+	}
+	if source.cached != "" {
+		logger.L().Ctx(ctx).Info("access token rotated", helpers.String("path", source.path))
+	}
+	source.modTime = info.ModTime()
+	source.cached = strings.TrimSpace(string(data))
+	return source.cached, nil
+}
+
+// secretTokenSource reads the token from a Kubernetes secret on every connection
+type secretTokenSource struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+	key       string
+}
+
+func (source *secretTokenSource) token(ctx context.Context) (string, error) {
+	secret, err := source.client.CoreV1().Secrets(source.namespace).Get(ctx, source.name, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to read access token secret: %w", err)
+	}
+	token, ok := secret.Data[source.key]
+	if !ok {
+		return "", fmt.Errorf("access token secret %s/%s has no key '%s'", source.namespace, source.name, source.key)
+	}
+	return strings.TrimSpace(string(token)), nil
+}
+
+// authorizationHeader returns the headers that authenticate a connection to the backend
+func authorizationHeader(ctx context.Context, source tokenSource) (http.Header, error) {
+	header := http.Header{}
+	if source == nil {
+		return header, nil
+	}
+	token, err := source.token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	header.Set("Authorization", "Bearer "+token)
+	return header, nil
+}
+
+// checkAuthenticationStatus tells an access token the backend rejected apart from other failures
+func checkAuthenticationStatus(resp *http.Response) error {
+	if resp != nil && (resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden) {
+		return fmt.Errorf("%w: %s", errAuthenticationFailed, resp.Status)
+	}
+	return nil
+}
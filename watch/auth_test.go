@@ -0,0 +1,71 @@
+package watch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestFileTokenSourceRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	assert.NoError(t, os.WriteFile(path, []byte("first\n"), 0600))
+	source := &fileTokenSource{path: path}
+
+	token, err := source.token(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "first", token)
+
+	assert.NoError(t, os.WriteFile(path, []byte("second"), 0600))
+	assert.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Minute)))
+	token, err = source.token(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "second", token)
+}
+
+func TestSecretTokenSource(t *testing.T) {
+	client := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kubescape", Name: "kollector-token"},
+		Data:       map[string][]byte{"token": []byte("s3cr3t")},
+	})
+	t.Setenv(AccessTokenSecretEnv, "kubescape/kollector-token")
+	source := createTokenSource(client)
+
+	header, err := authorizationHeader(context.Background(), source)
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer s3cr3t", header.Get("Authorization"))
+
+	t.Setenv(AccessTokenSecretKeyEnv, "missing")
+	_, err = createTokenSource(client).token(context.Background())
+	assert.Error(t, err)
+}
+
+func TestHTTPSinkAuthenticationFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer good" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "token")
+	assert.NoError(t, os.WriteFile(path, []byte("bad"), 0600))
+	u, _ := url.Parse(server.URL)
+	spool, _ := newReportSpool("", 0, 0)
+	sink := newHTTPSink(u, spool, nil, &fileTokenSource{path: path})
+
+	assert.ErrorIs(t, sink.post(context.Background(), []byte("[]")), errAuthenticationFailed)
+
+	assert.NoError(t, os.WriteFile(path, []byte("good"), 0600))
+	assert.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Minute)))
+	assert.NoError(t, sink.post(context.Background(), []byte("[]")))
+}
@@ -0,0 +1,45 @@
+package watch
+
+import (
+	"math/rand"
+	"time"
+)
+
+// backoff computes jittered exponential delays between reconnection attempts
+type backoff struct {
+	initial time.Duration
+	max     time.Duration
+	attempt int
+}
+
+func newBackoff(initial, max time.Duration) *backoff {
+	if initial <= 0 {
+		initial = time.Second
+	}
+	if max < initial {
+		max = initial
+	}
+	return &backoff{initial: initial, max: max}
+}
+
+// next returns the delay before the next attempt. The delay doubles on every call up to the ceiling,
+// and a random jitter of up to half of the delay is subtracted so replicas do not reconnect in lockstep
+func (b *backoff) next() time.Duration {
+	delay := b.max
+	if b.attempt < 32 {
+		if d := b.initial << uint(b.attempt); d > 0 && d < b.max {
+			delay = d
+		}
+	}
+	b.attempt++
+	half := int64(delay / 2)
+	if half <= 0 {
+		return delay
+	}
+	return delay - time.Duration(rand.Int63n(half+1))
+}
+
+// reset restarts the delay sequence after a successful attempt
+func (b *backoff) reset() {
+	b.attempt = 0
+}
@@ -0,0 +1,25 @@
+package watch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoff(t *testing.T) {
+	b := newBackoff(time.Second, 8*time.Second)
+	for _, ceiling := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 8 * time.Second} {
+		delay := b.next()
+		assert.LessOrEqual(t, delay, ceiling)
+		assert.GreaterOrEqual(t, delay, ceiling/2)
+	}
+
+	b.reset()
+	assert.LessOrEqual(t, b.next(), time.Second)
+}
+
+func TestBackoffCeilingBelowInitial(t *testing.T) {
+	b := newBackoff(5*time.Second, time.Second)
+	assert.LessOrEqual(t, b.next(), 5*time.Second)
+}
@@ -0,0 +1,95 @@
+package watch
+
+import (
+	"encoding/json"
+	"fmt"
+
+	logger "github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+)
+
+const (
+	MaxMessageSizeEnv = "MAX_MESSAGE_SIZE"
+)
+
+const (
+	// chunkEnvelopeOverhead is reserved in every chunk for the envelope fields around the payload
+	chunkEnvelopeOverhead = 512
+	minChunkPayloadSize   = 1024
+	// minMessageSize is the smallest message that holds a chunk envelope and a base64 encoded minimal payload
+	minMessageSize = chunkEnvelopeOverhead + (minChunkPayloadSize+2)/3*4
+)
+
+// maxMessageSize returns the message size limit from the environment. A limit too small to hold a chunk is raised to
+// minMessageSize, so every chunk still fits in the limit in effect
+func maxMessageSize() int {
+	size := getNumericValueFromEnvVar(MaxMessageSizeEnv, 0)
+	if size > 0 && size < minMessageSize {
+		logger.L().Warning("message size limit is too small to hold a chunk, raising it", helpers.Int("configured", size), helpers.Int("limit", minMessageSize))
+		return minMessageSize
+	}
+	return size
+}
+
+// reportChunk is a numbered part of a report that is larger than the message size limit.
+// The backend applies the report only after it received all chunkCount chunks of reportID
+type reportChunk struct {
+	ReportID       string `json:"reportID"`
+	SequenceNumber uint64 `json:"sequenceNumber"`
+	FirstReport    bool   `json:"firstReport"`
+	ChunkIndex     int    `json:"chunkIndex"`
+	ChunkCount     int    `json:"chunkCount"`
+	// Payload is a slice of the report JSON, the chunks' payloads concatenated in chunkIndex order form the report
+	Payload []byte `json:"payload"`
+}
+
+// reportHeader holds the report fields every chunk repeats
+type reportHeader struct {
+	FirstReport    bool   `json:"firstReport"`
+	SequenceNumber uint64 `json:"sequenceNumber"`
+	ReportID       string `json:"reportID"`
+}
+
+// reportChunkMessage wraps a chunk, so the backend can tell it apart from a whole report
+type reportChunkMessage struct {
+	Chunk *reportChunk `json:"chunk"`
+}
+
+// splitReport splits a report larger than maxSize bytes into chunk messages of at most maxSize bytes, a maxSize below
+// minMessageSize is raised to it. A report that fits, or a maxSize of 0, returns the report as is
+func splitReport(report []byte, maxSize int) ([][]byte, error) {
+	if maxSize <= 0 || len(report) <= maxSize {
+		return [][]byte{report}, nil
+	}
+	if maxSize < minMessageSize {
+		maxSize = minMessageSize
+	}
+	header := reportHeader{}
+	if err := json.Unmarshal(report, &header); err != nil {
+		return nil, fmt.Errorf("failed to read report header: %w", err)
+	}
+
+	// the payload is base64 encoded, which takes 4 bytes for every 3 bytes of the report
+	payloadSize := (maxSize - chunkEnvelopeOverhead) / 4 * 3
+	chunkCount := (len(report) + payloadSize - 1) / payloadSize
+	messages := make([][]byte, 0, chunkCount)
+	for i := 0; i < chunkCount; i++ {
+		end := (i + 1) * payloadSize
+		if end > len(report) {
+			end = len(report)
+		}
+		message, err := json.Marshal(reportChunkMessage{Chunk: &reportChunk{
+			ReportID:       header.ReportID,
+			SequenceNumber: header.SequenceNumber,
+			FirstReport:    header.FirstReport,
+			ChunkIndex:     i,
+			ChunkCount:     chunkCount,
+			Payload:        report[i*payloadSize : end],
+		}})
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+	return messages, nil
+}
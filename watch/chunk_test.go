@@ -0,0 +1,65 @@
+package watch
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitReport(t *testing.T) {
+	report, err := json.Marshal(jsonFormat{FirstReport: true, SequenceNumber: 7, ReportID: "report", CloudVendor: strings.Repeat("é", 10000)})
+	assert.NoError(t, err)
+
+	messages, err := splitReport(report, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]byte{report}, messages)
+	messages, err = splitReport(report, len(report))
+	assert.NoError(t, err)
+	assert.Equal(t, [][]byte{report}, messages)
+
+	maxSize := 4096
+	messages, err = splitReport(report, maxSize)
+	assert.NoError(t, err)
+	assert.Greater(t, len(messages), 1)
+
+	reassembled := bytes.Buffer{}
+	for i := range messages {
+		assert.LessOrEqual(t, len(messages[i]), maxSize)
+		message := reportChunkMessage{}
+		assert.NoError(t, json.Unmarshal(messages[i], &message))
+		assert.Equal(t, "report", message.Chunk.ReportID)
+		assert.Equal(t, uint64(7), message.Chunk.SequenceNumber)
+		assert.True(t, message.Chunk.FirstReport)
+		assert.Equal(t, i, message.Chunk.ChunkIndex)
+		assert.Equal(t, len(messages), message.Chunk.ChunkCount)
+		reassembled.Write(message.Chunk.Payload)
+	}
+	assert.Equal(t, report, reassembled.Bytes())
+
+	_, err = splitReport([]byte(strings.Repeat("x", 2*maxSize)), maxSize)
+	assert.Error(t, err)
+}
+
+func TestSplitReportWithTinyLimit(t *testing.T) {
+	t.Setenv(MaxMessageSizeEnv, "100")
+	assert.Equal(t, minMessageSize, maxMessageSize())
+	t.Setenv(MaxMessageSizeEnv, "0")
+	assert.Equal(t, 0, maxMessageSize())
+
+	report, err := json.Marshal(jsonFormat{SequenceNumber: 3, ReportID: "report", CloudVendor: strings.Repeat("x", 10000)})
+	assert.NoError(t, err)
+	messages, err := splitReport(report, 100)
+	assert.NoError(t, err)
+	assert.Greater(t, len(messages), 1)
+	reassembled := bytes.Buffer{}
+	for i := range messages {
+		assert.LessOrEqual(t, len(messages[i]), minMessageSize)
+		message := reportChunkMessage{}
+		assert.NoError(t, json.Unmarshal(messages[i], &message))
+		reassembled.Write(message.Chunk.Payload)
+	}
+	assert.Equal(t, report, reassembled.Bytes())
+}
@@ -0,0 +1,100 @@
+package watch
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	CoalesceWindowEnv = "COALESCE_WINDOW"
+)
+
+// coalescer keeps the latest event of every object until the coalescing window ends
+type coalescer struct {
+	mutex  sync.Mutex
+	order  []types.UID
+	events map[types.UID]watch.Event
+}
+
+func newCoalescer() *coalescer {
+	return &coalescer{events: map[types.UID]watch.Event{}}
+}
+
+// add merges the event with the pending event of the same object. An object created in the window stays created with
+// its latest state, and an object created and deleted in the window is not reported at all
+func (c *coalescer) add(event watch.Event) {
+	uid := objectUID(event.Object)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	pending, ok := c.events[uid]
+	switch {
+	case !ok:
+		c.order = append(c.order, uid)
+		c.events[uid] = event
+	case pending.Type == watch.Added && event.Type == watch.Deleted:
+		delete(c.events, uid)
+	case pending.Type == watch.Added:
+		c.events[uid] = watch.Event{Type: watch.Added, Object: event.Object}
+	default:
+		c.events[uid] = event
+	}
+}
+
+// drain returns the pending events in the order their objects first changed
+func (c *coalescer) drain() []watch.Event {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	events := make([]watch.Event, 0, len(c.events))
+	for _, uid := range c.order {
+		if event, ok := c.events[uid]; ok {
+			events = append(events, event)
+			delete(c.events, uid)
+		}
+	}
+	c.order = nil
+	return events
+}
+
+// objectUID keys the events of an object, the objects without UID are keyed by namespace/name
+func objectUID(obj runtime.Object) types.UID {
+	if accessor, err := meta.Accessor(obj); err == nil && accessor.GetUID() != "" {
+		return accessor.GetUID()
+	}
+	key, _ := cache.MetaNamespaceKeyFunc(obj)
+	return types.UID(key)
+}
+
+// flushCoalesced queues the coalesced events for the watcher at the end of every window
+func (ie *informerEvents) flushCoalesced(ctx context.Context, window time.Duration) {
+	ticker := time.NewTicker(window)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		ie.enqueue(ie.coalescer.drain()...)
+	}
+}
+
+// waitReportInterval waits for the coalescing window after a report was sent, so a report is sent at most once per
+// window. It returns false when ctx is done first
+func (wh *WatchHandler) waitReportInterval(ctx context.Context) bool {
+	if wh.coalesceWindow <= 0 {
+		return true
+	}
+	select {
+	case <-time.After(wh.coalesceWindow):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
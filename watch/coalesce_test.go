@@ -0,0 +1,85 @@
+package watch
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCoalescer(t *testing.T) {
+	pod := func(uid types.UID, phase core.PodPhase) *core.Pod {
+		return &core.Pod{ObjectMeta: metav1.ObjectMeta{UID: uid, Name: string(uid)}, Status: core.PodStatus{Phase: phase}}
+	}
+	c := newCoalescer()
+	c.add(watch.Event{Type: watch.Added, Object: pod("created", core.PodPending)})
+	c.add(watch.Event{Type: watch.Modified, Object: pod("updated", core.PodPending)})
+	c.add(watch.Event{Type: watch.Modified, Object: pod("created", core.PodRunning)})
+	c.add(watch.Event{Type: watch.Modified, Object: pod("updated", core.PodRunning)})
+	c.add(watch.Event{Type: watch.Added, Object: pod("short-lived", core.PodPending)})
+	c.add(watch.Event{Type: watch.Deleted, Object: pod("short-lived", core.PodPending)})
+	c.add(watch.Event{Type: watch.Modified, Object: pod("deleted", core.PodRunning)})
+	c.add(watch.Event{Type: watch.Deleted, Object: pod("deleted", core.PodSucceeded)})
+
+	events := c.drain()
+	assert.Len(t, events, 3)
+	assert.Equal(t, watch.Added, events[0].Type)
+	assert.Equal(t, core.PodRunning, events[0].Object.(*core.Pod).Status.Phase)
+	assert.Equal(t, watch.Modified, events[1].Type)
+	assert.Equal(t, core.PodRunning, events[1].Object.(*core.Pod).Status.Phase)
+	assert.Equal(t, watch.Deleted, events[2].Type)
+	assert.Equal(t, types.UID("deleted"), events[2].Object.(*core.Pod).UID)
+	assert.Empty(t, c.drain())
+}
+
+func TestWatchInformerCoalesces(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	wh := &WatchHandler{informerFactory: newInformerFactory(client), informers: make(map[string]*informerEvents), coalesceWindow: 200 * time.Millisecond}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	nodes := wh.watchInformer(ctx, "nodes", wh.informerFactory.Core().V1().Nodes().Informer())
+	node := &core.Node{ObjectMeta: metav1.ObjectMeta{Name: "node", UID: "node", ResourceVersion: "1"}}
+	_, err := client.CoreV1().Nodes().Create(ctx, node, metav1.CreateOptions{})
+	assert.NoError(t, err)
+	node.ResourceVersion = "2"
+	node.Labels = map[string]string{"role": "worker"}
+	_, err = client.CoreV1().Nodes().Update(ctx, node, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+
+	event := nextEvent(t, nodes.next())
+	assert.Equal(t, watch.Added, event.Type)
+	assert.Equal(t, "worker", event.Object.(*core.Node).Labels["role"])
+	select {
+	case event := <-nodes.next():
+		t.Fatalf("unexpected event %s", event.Type)
+	case <-time.After(400 * time.Millisecond):
+	}
+}
+
+func TestCoalescedEventsReportedOnStop(t *testing.T) {
+	wh := &WatchHandler{informNewDataChannel: make(chan int, 1), includeNamespaces: []string{""}, clusterAPIServerVersion: &version.Info{}}
+	events := newInformerEvents("rollouts", nil, nil)
+	events.coalescer = newCoalescer()
+	events.reporting.Store(true)
+	rollout := &unstructured.Unstructured{}
+	rollout.SetAPIVersion("argoproj.io/v1alpha1")
+	rollout.SetKind("Rollout")
+	rollout.SetNamespace("default")
+	rollout.SetName("web")
+	events.send(watch.Added, rollout)
+
+	// the watcher stops before the window ends, the coalesced event is still in the last report
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	wh.handleDynamicWatch(ctx, events, make(chan bool))
+	assert.Equal(t, 1, wh.pendingObjects())
+}
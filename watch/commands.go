@@ -0,0 +1,86 @@
+package watch
+
+import (
+	"context"
+	"fmt"
+
+	logger "github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+)
+
+const (
+	ResyncCommand           = "resync"
+	PauseCommand            = "pause"
+	ResumeCommand           = "resume"
+	SetLogLevelCommand      = "setLogLevel"
+	IncludeNamespaceCommand = "includeNamespace"
+	ExcludeNamespaceCommand = "excludeNamespace"
+)
+
+const (
+	commandStatusOK    = "ok"
+	commandStatusError = "error"
+)
+
+// controlCommand is a command the backend sends to kollector
+type controlCommand struct {
+	ID   string            `json:"id"`
+	Name string            `json:"name"`
+	Args map[string]string `json:"args,omitempty"`
+}
+
+// commandResponse is the status reply to a controlCommand
+type commandResponse struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// commandHandler executes a control command
+type commandHandler func(ctx context.Context, command *controlCommand) error
+
+// commandSink is implemented by the sinks that receive control commands from the backend
+type commandSink interface {
+	setCommandHandler(handler commandHandler)
+}
+
+func newCommandResponse(command *controlCommand, err error) *commandResponse {
+	response := &commandResponse{ID: command.ID, Name: command.Name, Status: commandStatusOK}
+	if err != nil {
+		response.Status = commandStatusError
+		response.Message = err.Error()
+	}
+	return response
+}
+
+// handleCommand executes a control command the backend sent
+func (wh *WatchHandler) handleCommand(ctx context.Context, command *controlCommand) error {
+	logger.L().Ctx(ctx).Info("received command", helpers.String("id", command.ID), helpers.String("name", command.Name), helpers.Interface("args", command.Args))
+	switch command.Name {
+	case ResyncCommand:
+		wh.SetFirstReportFlag(true)
+	case PauseCommand:
+		wh.reportingPaused.Store(true)
+	case ResumeCommand:
+		if wh.reportingPaused.Swap(false) {
+			// send the changes that were aggregated while reporting was paused
+			wh.wakeSender()
+		}
+	case SetLogLevelCommand:
+		if err := logger.L().SetLevel(command.Args["level"]); err != nil {
+			return err
+		}
+	case IncludeNamespaceCommand, ExcludeNamespaceCommand:
+		namespace := command.Args["namespace"]
+		if namespace == "" {
+			return fmt.Errorf("missing namespace argument")
+		}
+		wh.setNamespaceWatched(namespace, command.Name == IncludeNamespaceCommand)
+		// the backend needs a new snapshot of the objects in the namespace
+		wh.SetFirstReportFlag(true)
+	default:
+		return fmt.Errorf("unknown command '%s'", command.Name)
+	}
+	return nil
+}
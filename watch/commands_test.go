@@ -0,0 +1,44 @@
+package watch
+
+import (
+	"context"
+	"testing"
+
+	logger "github.com/kubescape/go-logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleCommand(t *testing.T) {
+	ctx := context.Background()
+	wh := &WatchHandler{includeNamespaces: []string{""}, informNewDataChannel: make(chan int, 1)}
+
+	assert.NoError(t, wh.handleCommand(ctx, &controlCommand{Name: PauseCommand}))
+	assert.True(t, wh.reportingPaused.Load())
+	assert.NoError(t, wh.handleCommand(ctx, &controlCommand{Name: ResumeCommand}))
+	assert.False(t, wh.reportingPaused.Load())
+
+	// the commands only request a new first report, the sender starts it
+	assert.NoError(t, wh.handleCommand(ctx, &controlCommand{Name: ResyncCommand}))
+	assert.True(t, wh.firstReportRequested.Load())
+	assert.False(t, wh.getFirstReportFlag())
+
+	assert.NoError(t, wh.handleCommand(ctx, &controlCommand{Name: ExcludeNamespaceCommand, Args: map[string]string{"namespace": "kube-system"}}))
+	assert.False(t, wh.isNamespaceWatched("kube-system"))
+	assert.True(t, wh.isNamespaceWatched("default"))
+	assert.NoError(t, wh.handleCommand(ctx, &controlCommand{Name: IncludeNamespaceCommand, Args: map[string]string{"namespace": "kube-system"}}))
+	assert.True(t, wh.isNamespaceWatched("kube-system"))
+	assert.Error(t, wh.handleCommand(ctx, &controlCommand{Name: IncludeNamespaceCommand}))
+
+	level := logger.L().GetLevel()
+	defer logger.L().SetLevel(level)
+	assert.NoError(t, wh.handleCommand(ctx, &controlCommand{Name: SetLogLevelCommand, Args: map[string]string{"level": "debug"}}))
+	assert.Error(t, wh.handleCommand(ctx, &controlCommand{Name: SetLogLevelCommand, Args: map[string]string{"level": "loud"}}))
+
+	assert.Error(t, wh.handleCommand(ctx, &controlCommand{Name: "reboot"}))
+}
+
+func TestNewCommandResponse(t *testing.T) {
+	command := &controlCommand{ID: "1", Name: ResyncCommand}
+	assert.Equal(t, &commandResponse{ID: "1", Name: ResyncCommand, Status: commandStatusOK}, newCommandResponse(command, nil))
+	assert.Equal(t, commandStatusError, newCommandResponse(command, assert.AnError).Status)
+}
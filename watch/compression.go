@@ -0,0 +1,116 @@
+package watch
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	ReportCompressionEnv = "REPORT_COMPRESSION"
+)
+
+const (
+	// deflateCompression negotiates permessage-deflate with the event receiver, the reports stay text messages
+	deflateCompression = "deflate"
+	// gzipEncoding and zstdEncoding send every report as compressed binary messages
+	gzipEncoding = "gzip"
+	zstdEncoding = "zstd"
+)
+
+var (
+	zstdEncoder     *zstd.Encoder
+	zstdEncoderErr  error
+	zstdEncoderOnce sync.Once
+)
+
+// newZstdEncoder creates the zstd encoder the reports share, once
+func newZstdEncoder() (*zstd.Encoder, error) {
+	zstdEncoderOnce.Do(func() {
+		if zstdEncoder, zstdEncoderErr = zstd.NewWriter(nil); zstdEncoderErr != nil {
+			zstdEncoderErr = fmt.Errorf("failed to create zstd encoder: %w", zstdEncoderErr)
+		}
+	})
+	return zstdEncoder, zstdEncoderErr
+}
+
+// encodedReportHeader describes the payload of a compressed binary message.
+// A binary message is the header JSON, a new line, and the raw payload bytes.
+// The payloads concatenated in chunkIndex order form the compressed report
+type encodedReportHeader struct {
+	reportHeader
+	ContentEncoding string `json:"contentEncoding"`
+	ChunkIndex      int    `json:"chunkIndex"`
+	ChunkCount      int    `json:"chunkCount"`
+}
+
+func isContentEncodingSupported(encoding string) bool {
+	return encoding == gzipEncoding || encoding == zstdEncoding
+}
+
+func compressReport(report []byte, encoding string) ([]byte, error) {
+	switch encoding {
+	case gzipEncoding:
+		buf := &bytes.Buffer{}
+		writer := gzip.NewWriter(buf)
+		if _, err := writer.Write(report); err != nil {
+			return nil, err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case zstdEncoding:
+		encoder, err := newZstdEncoder()
+		if err != nil {
+			return nil, err
+		}
+		return encoder.EncodeAll(report, make([]byte, 0, len(report)/8)), nil
+	}
+	return nil, fmt.Errorf("unsupported content encoding '%s'", encoding)
+}
+
+// encodeReport compresses a report and splits it into binary messages of at most maxSize bytes. A maxSize of 0 never splits
+func encodeReport(report []byte, encoding string, maxSize int) ([][]byte, error) {
+	header := encodedReportHeader{ContentEncoding: encoding}
+	if err := json.Unmarshal(report, &header.reportHeader); err != nil {
+		return nil, fmt.Errorf("failed to read report header: %w", err)
+	}
+	payload, err := compressReport(report, encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	payloadSize := len(payload)
+	if maxSize > 0 {
+		payloadSize = maxSize - chunkEnvelopeOverhead
+		if payloadSize < minChunkPayloadSize {
+			payloadSize = minChunkPayloadSize
+		}
+	}
+	header.ChunkCount = (len(payload) + payloadSize - 1) / payloadSize
+	if header.ChunkCount == 0 {
+		header.ChunkCount = 1
+	}
+	messages := make([][]byte, 0, header.ChunkCount)
+	for header.ChunkIndex = 0; header.ChunkIndex < header.ChunkCount; header.ChunkIndex++ {
+		start := header.ChunkIndex * payloadSize
+		end := start + payloadSize
+		if end > len(payload) {
+			end = len(payload)
+		}
+		headerBytes, err := json.Marshal(header)
+		if err != nil {
+			return nil, err
+		}
+		message := make([]byte, 0, len(headerBytes)+1+end-start)
+		message = append(message, headerBytes...)
+		message = append(message, '\n')
+		messages = append(messages, append(message, payload[start:end]...))
+	}
+	return messages, nil
+}
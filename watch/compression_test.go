@@ -0,0 +1,122 @@
+package watch
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// podHeavyFirstReport builds a first report of a cluster running workloads workloads with podsPerWorkload pods each
+func podHeavyFirstReport(t testing.TB, workloads, podsPerWorkload int) []byte {
+	report := jsonFormat{FirstReport: true, SequenceNumber: 1, ReportID: "report"}
+	for i := 0; i < workloads; i++ {
+		pod := &core.Pod{}
+		od := OwnerDet{}
+		assert.NoError(t, json.Unmarshal([]byte(runningPodJson), pod))
+		assert.NoError(t, json.Unmarshal([]byte(runningPodOD), &od))
+		pod.Name = fmt.Sprintf("nginx-%d-5d59d67564-abcde", i)
+		pod.Namespace = fmt.Sprintf("namespace-%d", i%50)
+		pod.UID = types.UID(fmt.Sprintf("155f59e9-3166-41f6-bf16-%012d", i))
+		od.Name = fmt.Sprintf("nginx-%d", i)
+		report.AddToJsonFormat(MicroServiceData{Pod: pod, Owner: od, PodSpecId: i}, MICROSERVICES, CREATED)
+		for j := 0; j < podsPerWorkload; j++ {
+			report.AddToJsonFormat(PodDataForExistMicroService{
+				PodName:           fmt.Sprintf("%s-%d", pod.Name, j),
+				NodeName:          fmt.Sprintf("node-%d", j),
+				PodIP:             fmt.Sprintf("10.0.%d.%d", i%256, j),
+				Namespace:         pod.Namespace,
+				Owner:             OwnerDetNameAndKindOnly{Name: od.Name, Kind: od.Kind},
+				PodStatus:         "Running",
+				CreationTimestamp: "2022-05-15T11:43:25Z",
+			}, PODS, CREATED)
+		}
+	}
+	data, err := json.Marshal(report)
+	assert.NoError(t, err)
+	return data
+}
+
+func decodeReport(t *testing.T, messages [][]byte) (encodedReportHeader, []byte) {
+	header := encodedReportHeader{}
+	payload := bytes.Buffer{}
+	for i := range messages {
+		headerBytes, chunk, found := bytes.Cut(messages[i], []byte("\n"))
+		assert.True(t, found)
+		assert.NoError(t, json.Unmarshal(headerBytes, &header))
+		assert.Equal(t, i, header.ChunkIndex)
+		assert.Equal(t, len(messages), header.ChunkCount)
+		payload.Write(chunk)
+	}
+
+	var report []byte
+	var err error
+	switch header.ContentEncoding {
+	case gzipEncoding:
+		reader, gzErr := gzip.NewReader(&payload)
+		assert.NoError(t, gzErr)
+		report, err = io.ReadAll(reader)
+	case zstdEncoding:
+		decoder, _ := zstd.NewReader(nil)
+		defer decoder.Close()
+		report, err = decoder.DecodeAll(payload.Bytes(), nil)
+	}
+	assert.NoError(t, err)
+	return header, report
+}
+
+func TestEncodeReport(t *testing.T) {
+	report := podHeavyFirstReport(t, 20, 3)
+	for _, encoding := range []string{gzipEncoding, zstdEncoding} {
+		for _, maxSize := range []int{0, 2048} {
+			messages, err := encodeReport(report, encoding, maxSize)
+			assert.NoError(t, err)
+			if maxSize > 0 {
+				assert.Greater(t, len(messages), 1)
+				for i := range messages {
+					assert.LessOrEqual(t, len(messages[i]), maxSize)
+				}
+			} else {
+				assert.Len(t, messages, 1)
+			}
+			header, decoded := decodeReport(t, messages)
+			assert.Equal(t, encoding, header.ContentEncoding)
+			assert.Equal(t, "report", header.ReportID)
+			assert.True(t, header.FirstReport)
+			assert.Equal(t, report, decoded)
+		}
+	}
+
+	_, err := encodeReport(report, "brotli", 0)
+	assert.Error(t, err)
+}
+
+func benchmarkCompressReport(b *testing.B, encoding string) {
+	report := podHeavyFirstReport(b, 2000, 3)
+	b.SetBytes(int64(len(report)))
+	b.ResetTimer()
+	var compressed []byte
+	for i := 0; i < b.N; i++ {
+		var err error
+		if compressed, err = compressReport(report, encoding); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(len(report))/float64(len(compressed)), "ratio")
+	b.ReportMetric(float64(len(compressed)), "compressed-bytes")
+}
+
+func BenchmarkCompressReportGzip(b *testing.B) {
+	benchmarkCompressReport(b, gzipEncoding)
+}
+
+func BenchmarkCompressReportZstd(b *testing.B) {
+	benchmarkCompressReport(b, zstdEncoding)
+}
@@ -3,7 +3,6 @@ package watch
 import (
 	"container/list"
 	"runtime/debug"
-	"time"
 
 	logger "github.com/kubescape/go-logger"
 	"github.com/kubescape/go-logger/helpers"
@@ -21,39 +20,37 @@ func (wh *WatchHandler) CronJobWatch(ctx context.Context) {
 			logger.L().Ctx(ctx).Error("RECOVER CronJobWatch", helpers.Interface("error", err), helpers.String("stack", string(debug.Stack())))
 		}
 	}()
-	var lastWatchEventCreationTime time.Time
-	newStateChan := make(chan bool)
-	wh.newStateReportChans = append(wh.newStateReportChans, newStateChan)
+	newStateChan, unregister := wh.registerNewStateChan()
+	defer unregister()
+	logger.L().Info("Watching over cronjobs starting")
+	cronjobs := wh.watchInformer(ctx, "cronjobs", wh.informerFactory.Batch().V1().CronJobs().Informer())
 	for {
-		logger.L().Info("Watching over cronjobs starting")
-		cronjobWatcher, err := wh.RestAPIClient.BatchV1().CronJobs("").Watch(globalHTTPContext, metav1.ListOptions{Watch: true})
-		if err != nil {
-			logger.L().Ctx(ctx).Error("Cannot watch over cronjobs", helpers.Error(err))
-			time.Sleep(3 * time.Second)
-			continue
+		wh.handleCronJobWatch(ctx, cronjobs, newStateChan)
+		if ctx.Err() != nil {
+			return
 		}
-		wh.handleCronJobWatch(ctx, cronjobWatcher, newStateChan, &lastWatchEventCreationTime)
-
-		logger.L().Info("Watching over cronjobs ended - since we got timeout")
+		// the new first report starts from an empty state and reports every existing object again
+		wh.cjm = make(map[int]*list.List)
+		cronjobs.replay()
 	}
 }
 
-func (wh *WatchHandler) handleCronJobWatch(ctx context.Context, cronjobWatcher watch.Interface, newStateChan <-chan bool, lastWatchEventCreationTime *time.Time) {
-	cronjobChan := cronjobWatcher.ResultChan()
+func (wh *WatchHandler) handleCronJobWatch(ctx context.Context, events *informerEvents, newStateChan <-chan bool) {
 	cronJobIDs := make(map[string]int)
 	logger.L().Info("Watching over cronjobs started")
 	for {
 		var event watch.Event
 		select {
-		case event = <-cronjobChan:
+		case event = <-events.next():
 		case <-newStateChan:
-			cronjobWatcher.Stop()
-			*lastWatchEventCreationTime = time.Now()
 			return
-		}
-		if event.Type == watch.Error {
-			logger.L().Ctx(ctx).Error("CronJob watch chan loop", helpers.Interface("error", event.Object))
-			*lastWatchEventCreationTime = time.Now()
+		case <-wh.cronJobChanges.changes():
+			wh.refreshWorkloads(wh.cjm, wh.cronJobChanges.take())
+			continue
+		case <-events.done(ctx):
+			if events.stop() {
+				continue
+			}
 			return
 		}
 		if cronjob, ok := event.Object.(*batchv1.CronJob); ok {
@@ -68,20 +65,19 @@ func (wh *WatchHandler) handleCronJobWatch(ctx context.Context, cronjobWatcher w
 			cronjob.ManagedFields = []metav1.ManagedFieldsEntry{}
 			switch event.Type {
 			case watch.Added:
-				if cronjob.CreationTimestamp.Time.Before(*lastWatchEventCreationTime) {
-					logger.L().Info("cronjob already exist, will not be reported", helpers.String("name", cronjob.Name))
-					continue
-				}
 				id := CreateID()
 				od := OwnerDet{
 					Name:      cronjob.Name,
 					Kind:      cronjob.Kind,
 					OwnerData: cronjob,
 				}
-				wh.pdm[id] = list.New()
 				nms := MicroServiceData{Pod: &v1.Pod{Spec: cronjob.Spec.JobTemplate.Spec.Template.Spec, TypeMeta: cronjob.TypeMeta, ObjectMeta: cronjob.ObjectMeta},
 					Owner: od, PodSpecId: id}
-				wh.jsonReport.AddToJsonFormat(nms, MICROSERVICES, CREATED)
+				wh.enrichMicroService(&nms)
+				// the cron jobs list keeps the cron job, so its network isolation and bindings are refreshed
+				wh.cjm[id] = list.New()
+				wh.cjm[id].PushBack(nms)
+				wh.addMicroService(nms, CREATED)
 				cronJobIDs[string(cronjob.GetUID())] = id
 				informNewDataArrive(wh)
 			case watch.Modified:
@@ -92,9 +88,17 @@ func (wh *WatchHandler) handleCronJobWatch(ctx context.Context, cronjobWatcher w
 				}
 				nms := MicroServiceData{Pod: &v1.Pod{Spec: cronjob.Spec.JobTemplate.Spec.Template.Spec, TypeMeta: cronjob.TypeMeta, ObjectMeta: cronjob.ObjectMeta},
 					Owner: od, PodSpecId: cronJobIDs[string(cronjob.GetUID())]}
-				wh.jsonReport.AddToJsonFormat(nms, MICROSERVICES, UPDATED)
+				wh.enrichMicroService(&nms)
+				if workload := wh.cjm[nms.PodSpecId]; workload != nil && workload.Front() != nil {
+					workload.Front().Value = nms
+				}
+				wh.addMicroService(nms, UPDATED)
 				informNewDataArrive(wh)
 			case watch.Deleted:
+				id, known := cronJobIDs[string(cronjob.GetUID())]
+				if known {
+					delete(wh.cjm, id)
+				}
 				delete(cronJobIDs, string(cronjob.GetUID()))
 				od := OwnerDet{
 					Name:      cronjob.Name,
@@ -102,19 +106,10 @@ func (wh *WatchHandler) handleCronJobWatch(ctx context.Context, cronjobWatcher w
 					OwnerData: cronjob,
 				}
 				nms := MicroServiceData{Pod: &v1.Pod{Spec: cronjob.Spec.JobTemplate.Spec.Template.Spec, TypeMeta: cronjob.TypeMeta, ObjectMeta: cronjob.ObjectMeta},
-					Owner: od, PodSpecId: cronJobIDs[string(cronjob.GetUID())]}
-				wh.jsonReport.AddToJsonFormat(nms, MICROSERVICES, DELETED)
+					Owner: od, PodSpecId: id}
+				wh.addMicroService(nms, DELETED)
 				informNewDataArrive(wh)
-			case watch.Bookmark: //only the resource version is changed but it's the same workload
-				continue
-			case watch.Error:
-				logger.L().Ctx(ctx).Error("while watching over cronjobs we got an error", helpers.Interface("error", event))
-				*lastWatchEventCreationTime = time.Now()
-				return
 			}
-		} else {
-			*lastWatchEventCreationTime = time.Now()
-			return
 		}
 	}
 }
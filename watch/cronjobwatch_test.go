@@ -0,0 +1,110 @@
+package watch
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCronJobWorkloadsAreRefreshed(t *testing.T) {
+	wh := &WatchHandler{
+		informerFactory:         newInformerFactory(fake.NewSimpleClientset()),
+		informNewDataChannel:    make(chan int, 1),
+		clusterAPIServerVersion: &version.Info{},
+		cjm:                     make(map[int]*list.List),
+		includeNamespaces:       []string{""},
+	}
+	policies := wh.informerFactory.Networking().V1().NetworkPolicies().Informer().GetStore()
+	policy := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "deny-ingress"},
+		Spec:       networkingv1.NetworkPolicySpec{PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "report"}}},
+	}
+	assert.NoError(t, policies.Add(policy))
+
+	cronjob := &batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "report", UID: types.UID("report")}}
+	cronjob.Spec.JobTemplate.Spec.Template = core.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "report"}}}
+	cronjobs := newInformerEvents("cronjobs", nil, nil)
+	newStateChan := make(chan bool)
+	done := make(chan struct{})
+	go func() {
+		wh.handleCronJobWatch(context.Background(), cronjobs, newStateChan)
+		close(done)
+	}()
+	cronjobs.events <- watch.Event{Type: watch.Added, Object: cronjob.DeepCopy()}
+	newStateChan <- true
+	<-done
+
+	assert.Len(t, wh.cjm, 1)
+	var id int
+	for id = range wh.cjm {
+	}
+	microService := wh.cjm[id].Front().Value.(MicroServiceData)
+	assert.Equal(t, &NetworkIsolation{IngressIsolated: true, Policies: []string{"deny-ingress"}}, microService.NetworkIsolation)
+
+	// the cron job is enriched again when the network policies change
+	assert.NoError(t, policies.Delete(policy))
+	wh.refreshWorkloads(wh.cjm, []string{"shop"})
+	assert.Equal(t, &NetworkIsolation{Unrestricted: true}, wh.cjm[id].Front().Value.(MicroServiceData).NetworkIsolation)
+	assert.Len(t, wh.jsonReport.MicroServices.Updated, 1)
+}
+
+func TestPodAndCronJobWatchersRunTogether(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	wh := &WatchHandler{
+		RestAPIClient:           client,
+		informerFactory:         newInformerFactory(client),
+		informNewDataChannel:    make(chan int, 1),
+		clusterAPIServerVersion: &version.Info{},
+		pdm:                     make(map[int]*list.List),
+		cjm:                     make(map[int]*list.List),
+		workloadChanges:         newNamespaceSet(),
+		cronJobChanges:          newNamespaceSet(),
+		includeNamespaces:       []string{""},
+	}
+	pods := newInformerEvents("pods", nil, nil)
+	cronjobs := newInformerEvents("cronjobs", nil, nil)
+	podsNewState := make(chan bool)
+	cronJobsNewState := make(chan bool)
+	var watchers sync.WaitGroup
+	watchers.Add(2)
+	go func() {
+		defer watchers.Done()
+		wh.handlePodWatch(context.Background(), pods, podsNewState, nil)
+	}()
+	go func() {
+		defer watchers.Done()
+		wh.handleCronJobWatch(context.Background(), cronjobs, cronJobsNewState)
+	}()
+
+	// both watchers refresh their own workloads while the other one reports its objects
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("report-%d", i)
+		pod := &core.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: name}}
+		pod.Spec.Containers = []core.Container{{Name: name, Image: name}}
+		_, err := client.CoreV1().Pods("shop").Create(context.Background(), pod, metav1.CreateOptions{})
+		assert.NoError(t, err)
+		pods.events <- watch.Event{Type: watch.Added, Object: pod.DeepCopy()}
+		cronjob := &batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: name, UID: types.UID(name)}}
+		cronjobs.events <- watch.Event{Type: watch.Added, Object: cronjob}
+		wh.workloadsChanged("shop")
+	}
+	podsNewState <- true
+	cronJobsNewState <- true
+	watchers.Wait()
+
+	assert.Equal(t, 20, len(wh.pdm))
+	assert.Equal(t, 20, len(wh.cjm))
+	assert.Equal(t, 40, len(wh.jsonReport.MicroServices.Created))
+}
@@ -0,0 +1,109 @@
+package watch
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"strings"
+
+	logger "github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+const (
+	WatchResourcesEnv = "WATCH_RESOURCES"
+)
+
+// parseWatchResources reads the resources listed in the WATCH_RESOURCES environment variable.
+// Every comma separated entry is group/version/resource, or version/resource for the core group
+func parseWatchResources() ([]schema.GroupVersionResource, error) {
+	resources := []schema.GroupVersionResource{}
+	for _, entry := range strings.Split(os.Getenv(WatchResourcesEnv), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.Split(entry, "/")
+		switch len(parts) {
+		case 2:
+			resources = append(resources, schema.GroupVersionResource{Version: parts[0], Resource: parts[1]})
+		case 3:
+			resources = append(resources, schema.GroupVersionResource{Group: parts[0], Version: parts[1], Resource: parts[2]})
+		default:
+			return nil, fmt.Errorf("invalid resource '%s' in %s, expected group/version/resource", entry, WatchResourcesEnv)
+		}
+	}
+	return resources, nil
+}
+
+// resourceKey is the key of an object kind in the resources section of the report, e.g. argoproj.io/v1alpha1/Rollout
+func resourceKey(gvk schema.GroupVersionKind) string {
+	return gvk.GroupVersion().String() + "/" + gvk.Kind
+}
+
+// DynamicResources returns the resources listed in WATCH_RESOURCES
+func (wh *WatchHandler) DynamicResources() []schema.GroupVersionResource {
+	return wh.dynamicResources
+}
+
+// DynamicWatch watch over a resource with the dynamic client
+func (wh *WatchHandler) DynamicWatch(ctx context.Context, gvr schema.GroupVersionResource) {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.L().Ctx(ctx).Error("RECOVER DynamicWatch", helpers.String("resource", gvr.String()), helpers.Interface("error", err), helpers.String("stack", string(debug.Stack())))
+		}
+	}()
+	newStateChan, unregister := wh.registerNewStateChan()
+	defer unregister()
+	logger.L().Info("Watching over resource starting", helpers.String("resource", gvr.String()))
+	resources := wh.watchInformer(ctx, gvr.String(), wh.dynamicInformerFactory.ForResource(gvr).Informer())
+	for {
+		wh.handleDynamicWatch(ctx, resources, newStateChan)
+		if ctx.Err() != nil {
+			return
+		}
+		// report every existing object again in the new first report
+		resources.replay()
+	}
+}
+
+func (wh *WatchHandler) handleDynamicWatch(ctx context.Context, events *informerEvents, newStateChan <-chan bool) {
+	for {
+		var event watch.Event
+		select {
+		case event = <-events.next():
+		case <-newStateChan:
+			return
+		case <-events.done(ctx):
+			if events.stop() {
+				continue
+			}
+			return
+		}
+		obj, ok := event.Object.(*unstructured.Unstructured)
+		if !ok {
+			logger.L().Ctx(ctx).Error("Watch error: cannot convert to unstructured", helpers.Interface("error", event))
+			continue
+		}
+		if obj.GetNamespace() != "" && !wh.isNamespaceWatched(obj.GetNamespace()) {
+			continue
+		}
+		obj.SetManagedFields(nil)
+		key := resourceKey(obj.GroupVersionKind())
+		switch event.Type {
+		case watch.Added:
+			wh.addResource(obj, key, CREATED)
+		case watch.Modified:
+			wh.addResource(obj, key, UPDATED)
+		case watch.Deleted:
+			wh.addResource(obj, key, DELETED)
+		default:
+			continue
+		}
+		informNewDataArrive(wh)
+	}
+}
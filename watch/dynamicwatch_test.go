@@ -0,0 +1,110 @@
+package watch
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func TestParseWatchResources(t *testing.T) {
+	t.Setenv(WatchResourcesEnv, "argoproj.io/v1alpha1/rollouts, v1/configmaps")
+	resources, err := parseWatchResources()
+	assert.NoError(t, err)
+	assert.Equal(t, []schema.GroupVersionResource{
+		{Group: "argoproj.io", Version: "v1alpha1", Resource: "rollouts"},
+		{Version: "v1", Resource: "configmaps"},
+	}, resources)
+
+	t.Setenv(WatchResourcesEnv, "rollouts")
+	_, err = parseWatchResources()
+	assert.Error(t, err)
+}
+
+func TestHandleDynamicWatch(t *testing.T) {
+	wh := &WatchHandler{
+		informNewDataChannel:    make(chan int, 10),
+		includeNamespaces:       []string{""},
+		excludeNamespaces:       []string{"kube-system"},
+		clusterAPIServerVersion: &version.Info{},
+	}
+	rollout := func(namespace, name string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion("argoproj.io/v1alpha1")
+		obj.SetKind("Rollout")
+		obj.SetNamespace(namespace)
+		obj.SetName(name)
+		return obj
+	}
+	events := newInformerEvents("rollouts", nil, nil)
+	newStateChan := make(chan bool)
+	go func() {
+		events.events <- watch.Event{Type: watch.Added, Object: rollout("default", "web")}
+		events.events <- watch.Event{Type: watch.Added, Object: rollout("kube-system", "ignored")}
+		events.events <- watch.Event{Type: watch.Deleted, Object: rollout("default", "web")}
+		newStateChan <- true
+	}()
+	wh.handleDynamicWatch(context.Background(), events, newStateChan)
+
+	report := jsonFormat{}
+	assert.NoError(t, json.Unmarshal(prepareDataToSend(context.Background(), wh), &report))
+	rollouts := report.Resources["argoproj.io/v1alpha1/Rollout"]
+	assert.Len(t, rollouts.Created, 1)
+	assert.Len(t, rollouts.Deleted, 1)
+
+	// the sent objects are not reported again
+	report = jsonFormat{}
+	assert.NoError(t, json.Unmarshal(prepareDataToSend(context.Background(), wh), &report))
+	assert.Nil(t, report.Resources)
+}
+
+func TestDynamicWatchersConcurrently(t *testing.T) {
+	wh := &WatchHandler{
+		informNewDataChannel:    make(chan int, 1),
+		includeNamespaces:       []string{""},
+		clusterAPIServerVersion: &version.Info{},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	const objects = 200
+	done := make(chan struct{})
+	for _, kind := range []string{"Rollout", "Experiment"} {
+		events := newInformerEvents(kind, nil, nil)
+		go wh.handleDynamicWatch(ctx, events, make(chan bool))
+		go func(kind string) {
+			for i := 0; i < objects; i++ {
+				obj := &unstructured.Unstructured{}
+				obj.SetAPIVersion("argoproj.io/v1alpha1")
+				obj.SetKind(kind)
+				obj.SetNamespace("default")
+				events.events <- watch.Event{Type: watch.Added, Object: obj}
+			}
+			done <- struct{}{}
+		}(kind)
+	}
+
+	taken := 0
+	for finished := 0; finished < 2; {
+		select {
+		case <-done:
+			finished++
+		default:
+		}
+		for _, resources := range wh.takeResources() {
+			taken += resources.Len()
+		}
+	}
+	// the last event of each watcher may still be added after its sender finished
+	assert.Eventually(t, func() bool {
+		for _, resources := range wh.takeResources() {
+			taken += resources.Len()
+		}
+		return taken == 2*objects
+	}, time.Second, 10*time.Millisecond)
+}
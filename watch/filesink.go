@@ -0,0 +1,61 @@
+package watch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	logger "github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+)
+
+// writerSink writes every report as a single line of NDJSON, to a file or to stdout
+type writerSink struct {
+	writer io.Writer
+	mutex  sync.Mutex
+}
+
+func newFileSink(path string) (*writerSink, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open report file: %w", err)
+	}
+	logger.L().Info("writing reports to file", helpers.String("path", path))
+	return newWriterSink(file), nil
+}
+
+func newWriterSink(writer io.Writer) *writerSink {
+	return &writerSink{writer: writer}
+}
+
+// Send writes the report followed by a new line. The report is shared with the other destinations, so the line is
+// written from a copy
+func (sink *writerSink) Send(seq uint64, report []byte, first bool) {
+	line := make([]byte, 0, len(report)+1)
+	line = append(append(line, report...), '\n')
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	if _, err := sink.writer.Write(line); err != nil {
+		logger.L().Error("failed to write report", helpers.Int("sequenceNumber", int(seq)), helpers.Error(err))
+	}
+}
+
+// Run has nothing to deliver, the reports are written as they are sent
+func (sink *writerSink) Run(ctx context.Context, isServerReady *atomic.Bool, resync func(bool)) error {
+	isServerReady.Store(true)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// Flush commits the written reports to disk, stdout needs no flushing
+func (sink *writerSink) Flush(ctx context.Context) error {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	if file, ok := sink.writer.(*os.File); ok && file != os.Stdout {
+		return file.Sync()
+	}
+	return nil
+}
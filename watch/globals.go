@@ -1,9 +0,0 @@
-package watch
-
-import (
-	"context"
-)
-
-var (
-	globalHTTPContext = context.Background()
-)
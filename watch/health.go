@@ -0,0 +1,195 @@
+package watch
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	WatcherStarting = "starting"
+	WatcherSyncing  = "syncing"
+	WatcherWatching = "watching"
+	WatcherErroring = "erroring"
+)
+
+const (
+	watchersHealthPath = "/healthz/watchers"
+	// watcherErrorWindow is how long a watcher is erroring after a failed list or watch, the informer retries it
+	// with a backoff shorter than the window, so a watcher that keeps failing never leaves the erroring state
+	watcherErrorWindow     = time.Minute
+	readinessCheckInterval = time.Second
+)
+
+// watcherStatus is the health of a watcher, it is updated by the watcher's informer
+type watcherStatus struct {
+	mutex         sync.RWMutex
+	informer      cache.SharedIndexInformer // nil until the informer started
+	lastEventTime time.Time
+	lastError     error
+	lastErrorTime time.Time
+}
+
+// watcherHealth is the state of a watcher on the /healthz/watchers endpoint
+type watcherHealth struct {
+	Name            string     `json:"name"`
+	State           string     `json:"state"`
+	ResourceVersion string     `json:"resourceVersion,omitempty"`
+	LastEventTime   *time.Time `json:"lastEventTime,omitempty"`
+	LastError       string     `json:"lastError,omitempty"`
+	LastErrorTime   *time.Time `json:"lastErrorTime,omitempty"`
+}
+
+func (status *watcherStatus) setInformer(informer cache.SharedIndexInformer) {
+	status.mutex.Lock()
+	defer status.mutex.Unlock()
+	status.informer = informer
+}
+
+func (status *watcherStatus) eventReceived() {
+	if status == nil {
+		return
+	}
+	status.mutex.Lock()
+	defer status.mutex.Unlock()
+	status.lastEventTime = time.Now()
+}
+
+func (status *watcherStatus) failed(err error) {
+	if status == nil {
+		return
+	}
+	status.mutex.Lock()
+	defer status.mutex.Unlock()
+	status.lastError = err
+	status.lastErrorTime = time.Now()
+}
+
+// synced reports whether the informer finished its initial list
+func (status *watcherStatus) synced() bool {
+	status.mutex.RLock()
+	defer status.mutex.RUnlock()
+	return status.informer != nil && status.informer.HasSynced()
+}
+
+func (status *watcherStatus) health(name string) watcherHealth {
+	status.mutex.RLock()
+	defer status.mutex.RUnlock()
+	health := watcherHealth{Name: name}
+	switch {
+	case status.informer == nil:
+		health.State = WatcherStarting
+	case status.lastError != nil && time.Since(status.lastErrorTime) < watcherErrorWindow && status.lastErrorTime.After(status.lastEventTime):
+		health.State = WatcherErroring
+	case !status.informer.HasSynced():
+		health.State = WatcherSyncing
+	default:
+		health.State = WatcherWatching
+	}
+	if status.informer != nil {
+		health.ResourceVersion = status.informer.LastSyncResourceVersion()
+	}
+	if !status.lastEventTime.IsZero() {
+		lastEventTime := status.lastEventTime
+		health.LastEventTime = &lastEventTime
+	}
+	if status.lastError != nil {
+		lastErrorTime := status.lastErrorTime
+		health.LastError = status.lastError.Error()
+		health.LastErrorTime = &lastErrorTime
+	}
+	return health
+}
+
+// watcherStatus returns the status of a watcher, it is created the first time a watcher asks for it
+func (wh *WatchHandler) watcherStatus(name string) *watcherStatus {
+	wh.statusesMutex.Lock()
+	defer wh.statusesMutex.Unlock()
+	if wh.statuses == nil {
+		wh.statuses = map[string]*watcherStatus{}
+	}
+	status, ok := wh.statuses[name]
+	if !ok {
+		status = &watcherStatus{}
+		wh.statuses[name] = status
+	}
+	return status
+}
+
+// watchedResources are the names of the informers the enabled watchers run
+func (wh *WatchHandler) watchedResources() []string {
+	resources := []string{}
+	for _, resource := range scopedResources {
+		if wh.IsWatcherEnabled(resource) {
+			resources = append(resources, resource)
+		}
+	}
+	for _, gvr := range wh.dynamicResources {
+		if wh.IsWatcherEnabled(gvr.String()) {
+			resources = append(resources, gvr.String())
+		}
+	}
+	return resources
+}
+
+// watchersHealth returns the state of every watcher, sorted by name
+func (wh *WatchHandler) watchersHealth() []watcherHealth {
+	resources := wh.watchedResources()
+	sort.Strings(resources)
+	health := make([]watcherHealth, 0, len(resources))
+	for _, resource := range resources {
+		health = append(health, wh.watcherStatus(resource).health(resource))
+	}
+	return health
+}
+
+// watchersReady reports whether every watcher finished its initial list
+func (wh *WatchHandler) watchersReady() bool {
+	for _, resource := range wh.watchedResources() {
+		if !wh.watcherStatus(resource).synced() {
+			return false
+		}
+	}
+	return true
+}
+
+// RegisterHealthHandler serves the state of the watchers on /healthz/watchers, on the readiness probe's server
+func (wh *WatchHandler) RegisterHealthHandler() {
+	http.HandleFunc(watchersHealthPath, wh.serveWatchersHealth)
+}
+
+func (wh *WatchHandler) serveWatchersHealth(w http.ResponseWriter, _ *http.Request) {
+	health := wh.watchersHealth()
+	status := http.StatusOK
+	for i := range health {
+		if health[i].State != WatcherWatching {
+			status = http.StatusServiceUnavailable
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Watchers []watcherHealth `json:"watchers"`
+	}{Watchers: health})
+}
+
+// UpdateReadiness keeps isServerReady set while the sink is ready and every watcher finished its initial list
+func (wh *WatchHandler) UpdateReadiness(ctx context.Context, sinkReady *atomic.Bool, isServerReady *bool) {
+	ticker := time.NewTicker(readinessCheckInterval)
+	defer ticker.Stop()
+	for {
+		*isServerReady = sinkReady.Load() && wh.watchersReady()
+		select {
+		case <-ctx.Done():
+			*isServerReady = false
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package watch
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	core "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestWatchersHealth(t *testing.T) {
+	client := fake.NewSimpleClientset(&core.Node{ObjectMeta: metav1.ObjectMeta{Name: "node"}})
+	wh := &WatchHandler{informerFactory: newInformerFactory(client), informers: make(map[string]*informerEvents)}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	assert.False(t, wh.watchersReady())
+	assert.Equal(t, WatcherStarting, wh.watcherStatus("pods").health("pods").State)
+
+	wh.WarmCaches(ctx)
+	assert.Eventually(t, wh.watchersReady, 3*time.Second, 10*time.Millisecond)
+	recorder := httptest.NewRecorder()
+	wh.serveWatchersHealth(recorder, httptest.NewRequest(http.MethodGet, watchersHealthPath, nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	forbidden := apierrors.NewForbidden(schema.GroupResource{Resource: "secrets"}, "", nil)
+	wh.informers["secrets"].onWatchError(nil, forbidden)
+	recorder = httptest.NewRecorder()
+	wh.serveWatchersHealth(recorder, httptest.NewRequest(http.MethodGet, watchersHealthPath, nil))
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+
+	var health struct {
+		Watchers []watcherHealth `json:"watchers"`
+	}
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &health))
+	assert.Len(t, health.Watchers, len(scopedResources))
+	for _, watcher := range health.Watchers {
+		if watcher.Name == "secrets" {
+			assert.Equal(t, WatcherErroring, watcher.State)
+			assert.Equal(t, forbidden.Error(), watcher.LastError)
+		} else {
+			assert.Equal(t, WatcherWatching, watcher.State)
+		}
+	}
+}
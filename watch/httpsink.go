@@ -0,0 +1,164 @@
+package watch
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+
+	"github.com/armosec/utils-k8s-go/armometadata"
+	logger "github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+)
+
+const (
+	EventReceiverRestPath = "/k8s/cluster-reports"
+	HTTPSinkBatchSizeEnv  = "HTTP_SINK_BATCH_SIZE"
+)
+
+// httpSink posts the reports in batches to the event receiver REST API
+type httpSink struct {
+	u         url.URL
+	client    *http.Client
+	spool     *reportSpool
+	batchSize int
+	backoff   *backoff
+	// tokens authenticates the requests, nil sends them unauthenticated
+	tokens tokenSource
+}
+
+func setRestURL(config *armometadata.ClusterConfig) (*url.URL, error) {
+	u, err := url.Parse(config.EventReceiverRestURL)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = EventReceiverRestPath
+	q := u.Query()
+	q.Add(customerGuidQueryParamKey, config.AccountID)
+	q.Add(clusterNameQueryParamKey, config.ClusterName)
+	u.RawQuery = q.Encode()
+
+	return u, nil
+}
+
+func newHTTPSink(u *url.URL, spool *reportSpool, tlsConfig *tls.Config, tokens tokenSource) *httpSink {
+	logger.L().Info("posting reports", helpers.String("URL", u.String()))
+	return &httpSink{
+		u:         *u,
+		client:    newHTTPClient(tlsConfig, 30*time.Second),
+		tokens:    tokens,
+		spool:     spool,
+		batchSize: getNumericValueFromEnvVar(HTTPSinkBatchSizeEnv, 10),
+		backoff: newBackoff(
+			time.Duration(getNumericValueFromEnvVar(ReconnectInitialBackoffEnv, 1))*time.Second,
+			time.Duration(getNumericValueFromEnvVar(ReconnectMaxBackoffEnv, 60))*time.Second),
+	}
+}
+
+// Send queues a report for the next batch
+func (sink *httpSink) Send(seq uint64, report []byte, first bool) {
+	sink.spool.push(seq, report, first)
+}
+
+// Flush waits until the spooled reports are posted
+func (sink *httpSink) Flush(ctx context.Context) error {
+	return sink.spool.flush(ctx)
+}
+
+func (sink *httpSink) lastSequence() uint64 {
+	return sink.spool.lastSequence()
+}
+
+// Run posts the queued reports. A batch that fails is posted again after a backoff
+func (sink *httpSink) Run(ctx context.Context, isServerReady *atomic.Bool, resync func(bool)) error {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.L().Ctx(ctx).Error("RECOVER httpSink", helpers.Interface("error", err), helpers.String("stack", string(debug.Stack())))
+		}
+	}()
+	sink.spool.setEvictHandler(func() { resync(true) })
+	isServerReady.Store(true)
+	for {
+		seqs, body := sink.nextBatch()
+		if len(seqs) == 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-sink.spool.ready():
+			}
+			continue
+		}
+		if err := sink.post(ctx, body); err != nil {
+			sink.spool.rewind()
+			delay := sink.backoff.next()
+			if errors.Is(err, errAuthenticationFailed) {
+				logger.L().Ctx(ctx).Error("event receiver rejected the access token, retrying", helpers.String("retryIn", delay.String()), helpers.Error(err))
+			} else {
+				logger.L().Ctx(ctx).Warning("failed to post reports, retrying", helpers.Int("reports", len(seqs)), helpers.String("retryIn", delay.String()), helpers.Error(err))
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(delay):
+			}
+			continue
+		}
+		sink.backoff.reset()
+		for _, seq := range seqs {
+			sink.spool.ack(seq)
+		}
+		logger.L().Ctx(ctx).Debug("reports posted", helpers.Int("reports", len(seqs)))
+	}
+}
+
+// nextBatch collects up to batchSize queued reports into a JSON array
+func (sink *httpSink) nextBatch() ([]uint64, []byte) {
+	seqs := []uint64{}
+	body := bytes.NewBufferString("[")
+	for len(seqs) < sink.batchSize || sink.batchSize <= 0 {
+		seq, report, ok := sink.spool.next()
+		if !ok {
+			break
+		}
+		if len(seqs) > 0 {
+			body.WriteByte(',')
+		}
+		body.Write(report)
+		seqs = append(seqs, seq)
+	}
+	body.WriteByte(']')
+	return seqs, body.Bytes()
+}
+
+func (sink *httpSink) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sink.u.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	header, err := authorizationHeader(ctx, sink.tokens)
+	if err != nil {
+		return err
+	}
+	req.Header = header
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := sink.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if err := checkAuthenticationStatus(resp); err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("http error: %s", resp.Status)
+	}
+	return nil
+}
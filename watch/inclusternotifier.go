@@ -17,14 +17,12 @@ import (
 	"github.com/kubescape/kollector/consts"
 )
 
-var defaultClientInClusterTrigger = http.DefaultClient
-
-func newInClusterNotifier(config *armometadata.ClusterConfig) iClusterNotifier {
+func newInClusterNotifier(config *armometadata.ClusterConfig, client *http.Client) iClusterNotifier {
 	trigger := os.Getenv(consts.ActivateScanOnNewImageFeatureEnvironmentVariable)
 	if !boolutils.StringToBool(trigger) {
 		return newSkipInClusterNotifier("", "", "")
 	}
-	return newClusterNotifierImpl(config.AccountID, config.ClusterName, config.GatewayRestURL)
+	return newClusterNotifierImpl(config.AccountID, config.ClusterName, config.GatewayRestURL, client)
 }
 
 type iClusterNotifier interface {
@@ -35,14 +33,16 @@ type clusterNotifierImpl struct {
 	clusterName  string
 	customerGuid string
 	notifierURL  *url.URL
+	client       *http.Client
 }
 
-func newClusterNotifierImpl(customerGuid, clusterName, notifierHost string) *clusterNotifierImpl {
+func newClusterNotifierImpl(customerGuid, clusterName, notifierHost string, client *http.Client) *clusterNotifierImpl {
 	logger.L().Info("setting up cluster trigger notification")
 	return &clusterNotifierImpl{
 		customerGuid: customerGuid,
 		clusterName:  clusterName,
 		notifierURL:  generateNotifierURL(notifierHost),
+		client:       client,
 	}
 }
 
@@ -94,7 +94,7 @@ func (notifier *clusterNotifierImpl) executeTriggeredNotification(body *bytes.Bu
 	}
 
 	logger.L().Info("send", helpers.String("url", notifier.notifierURL.String()))
-	resp, err := defaultClientInClusterTrigger.Do(req)
+	resp, err := notifier.client.Do(req)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,310 @@
+package watch
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	logger "github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	InformerResyncPeriodEnv = "INFORMER_RESYNC_PERIOD"
+)
+
+// informerEvents feeds the notifications of a shared informer to a watcher as watch events
+type informerEvents struct {
+	name     string
+	informer cache.SharedIndexInformer
+	events   chan watch.Event
+	status   *watcherStatus
+	// coalescer merges the events of an object within COALESCE_WINDOW, it is nil when the window is 0
+	coalescer *coalescer
+	// reporting is false while a standby replica only keeps the informer's cache warm
+	reporting atomic.Bool
+	// queued are the events the watcher handles before the informer's next event, e.g. the objects of a replay.
+	// ready holds the first of them, so the watcher can select on it
+	queueMutex sync.Mutex
+	queued     []watch.Event
+	ready      chan watch.Event
+	// corrected are the last corrections of a reconcile by namespace/name, the informer's event that brings the same
+	// change later is dropped
+	corrected map[string]watch.Event
+}
+
+func newInformerEvents(name string, informer cache.SharedIndexInformer, status *watcherStatus) *informerEvents {
+	return &informerEvents{name: name, informer: informer, events: make(chan watch.Event), ready: make(chan watch.Event, 1), status: status}
+}
+
+func newInformerFactory(client kubernetes.Interface) informers.SharedInformerFactory {
+	resync := time.Duration(getNumericValueFromEnvVar(InformerResyncPeriodEnv, 0)) * time.Second
+	factory := informers.NewSharedInformerFactory(client, resync)
+	registerScopedInformers(factory)
+	return factory
+}
+
+func newDynamicInformerFactory(client dynamic.Interface) dynamicinformer.DynamicSharedInformerFactory {
+	resync := time.Duration(getNumericValueFromEnvVar(InformerResyncPeriodEnv, 0)) * time.Second
+	return dynamicinformer.NewDynamicSharedInformerFactory(client, resync)
+}
+
+// watchInformer starts the informer of a resource and returns its events. The informer lists the resource before
+// it watches it, and lists it again when the watch expires, so no change is lost while the watch reconnects
+func (wh *WatchHandler) watchInformer(ctx context.Context, name string, informer cache.SharedIndexInformer) *informerEvents {
+	wh.watcherStatus(name)
+	wh.waitForNamespaceScope(ctx)
+	return wh.startInformer(ctx, name, informer, true)
+}
+
+// startInformer starts the informer of a resource once. Its events are dropped until a watcher reports them
+func (wh *WatchHandler) startInformer(ctx context.Context, name string, informer cache.SharedIndexInformer, report bool) *informerEvents {
+	wh.informersMutex.Lock()
+	defer wh.informersMutex.Unlock()
+	if existing, ok := wh.informers[name]; ok {
+		if report && !existing.reporting.Swap(true) {
+			// the cache was kept warm without reporting, the watcher reports every object it holds
+			existing.replay()
+		}
+		return existing
+	}
+
+	ie := newInformerEvents(name, informer, wh.watcherStatus(name))
+	ie.reporting.Store(report)
+	if wh.coalesceWindow > 0 {
+		ie.coalescer = newCoalescer()
+		go ie.flushCoalesced(ctx, wh.coalesceWindow)
+	}
+	if err := informer.SetWatchErrorHandler(ie.onWatchError); err != nil {
+		logger.L().Ctx(ctx).Warning("failed to set watch error handler", helpers.String("resource", name), helpers.Error(err))
+	}
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    ie.onAdd,
+		UpdateFunc: ie.onUpdate,
+		DeleteFunc: ie.onDelete,
+	})
+	wh.informers[name] = ie
+	ie.status.setInformer(informer)
+	wh.informerFactory.Start(ctx.Done())
+	if wh.dynamicInformerFactory != nil {
+		wh.dynamicInformerFactory.Start(ctx.Done())
+	}
+	logger.L().Ctx(ctx).Info("informer started", helpers.String("resource", name))
+	return ie
+}
+
+func (ie *informerEvents) onAdd(obj interface{}) {
+	ie.send(watch.Added, obj)
+}
+
+// onUpdate skips the objects whose resourceVersion did not change, the relist after an expired watch and the
+// periodic resync deliver every cached object as an update, and only the objects that changed meanwhile are reported
+func (ie *informerEvents) onUpdate(oldObj, newObj interface{}) {
+	oldMeta, oldErr := meta.Accessor(oldObj)
+	newMeta, newErr := meta.Accessor(newObj)
+	if oldErr == nil && newErr == nil && oldMeta.GetResourceVersion() == newMeta.GetResourceVersion() {
+		return
+	}
+	ie.send(watch.Modified, newObj)
+}
+
+func (ie *informerEvents) onDelete(obj interface{}) {
+	// the watch missed the deletion and the relist found the object gone
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		logger.L().Debug("object deleted while the watch was down", helpers.String("resource", ie.name), helpers.String("key", tombstone.Key))
+		obj = tombstone.Obj
+	}
+	ie.send(watch.Deleted, obj)
+}
+
+// onWatchError logs why the watch stopped and records the failed watches in the watcher's health. The informer
+// resumes the watch from the last resourceVersion it saw, the watch requests bookmarks so that version stays recent
+// while nothing changes, and relists when the API server no longer has that version
+func (ie *informerEvents) onWatchError(_ *cache.Reflector, err error) {
+	switch {
+	case apierrors.IsResourceExpired(err) || apierrors.IsGone(err):
+		logger.L().Info("watch expired, relisting", helpers.String("resource", ie.name), helpers.String("resourceVersion", ie.resourceVersion()))
+	case err == io.EOF:
+		// the API server closed the watch, it is resumed from the last resourceVersion
+	default:
+		ie.status.failed(err)
+		logger.L().Warning("watch failed, resuming", helpers.String("resource", ie.name), helpers.String("resourceVersion", ie.resourceVersion()), helpers.Error(err))
+	}
+}
+
+// resourceVersion is the last resourceVersion the watch saw, including the bookmarks of the API server
+func (ie *informerEvents) resourceVersion() string {
+	if ie.informer == nil {
+		return ""
+	}
+	return ie.informer.LastSyncResourceVersion()
+}
+
+// send passes a copy of the object, the handlers modify the objects they get and the informer's cache must stay intact
+func (ie *informerEvents) send(eventType watch.EventType, obj interface{}) {
+	ie.status.eventReceived()
+	if !ie.reporting.Load() {
+		return
+	}
+	object, ok := obj.(runtime.Object)
+	if !ok {
+		logger.L().Error("informer sent an unexpected object", helpers.String("resource", ie.name), helpers.Interface("object", obj))
+		return
+	}
+	if ie.wasCorrected(eventType, object) {
+		return
+	}
+	event := watch.Event{Type: eventType, Object: object.DeepCopyObject()}
+	if ie.coalescer != nil {
+		ie.coalescer.add(event)
+		return
+	}
+	ie.events <- event
+}
+
+// next returns the channel the watcher reads its next event from, the queued events come before the informer's events.
+// The coalesced events are queued at the end of every window. Only the watcher's goroutine reads the events
+func (ie *informerEvents) next() <-chan watch.Event {
+	ie.queueMutex.Lock()
+	defer ie.queueMutex.Unlock()
+	ie.fillReady()
+	if len(ie.ready) > 0 || ie.coalescer != nil {
+		return ie.ready
+	}
+	return ie.events
+}
+
+// done returns ctx.Done() once nothing is queued, so the watcher handles the queued events before it stops
+func (ie *informerEvents) done(ctx context.Context) <-chan struct{} {
+	ie.queueMutex.Lock()
+	defer ie.queueMutex.Unlock()
+	if len(ie.ready) > 0 || len(ie.queued) > 0 {
+		return nil
+	}
+	return ctx.Done()
+}
+
+// stop queues the events still coalesced when the watcher stops, so they are in the last report. It returns false
+// when nothing is left to handle
+func (ie *informerEvents) stop() bool {
+	if ie.coalescer == nil {
+		return false
+	}
+	events := ie.coalescer.drain()
+	ie.enqueue(events...)
+	return len(events) > 0
+}
+
+// enqueue queues events the watcher handles before the informer's next event
+func (ie *informerEvents) enqueue(events ...watch.Event) {
+	ie.queueMutex.Lock()
+	defer ie.queueMutex.Unlock()
+	ie.queued = append(ie.queued, events...)
+	ie.fillReady()
+}
+
+// correct queues the corrections of a reconcile, the informer's events that bring the same changes are dropped
+func (ie *informerEvents) correct(corrections ...watch.Event) {
+	ie.queueMutex.Lock()
+	if ie.corrected == nil {
+		ie.corrected = map[string]watch.Event{}
+	}
+	for _, correction := range corrections {
+		if key, err := cache.MetaNamespaceKeyFunc(correction.Object); err == nil {
+			ie.corrected[key] = correction
+		}
+	}
+	ie.queueMutex.Unlock()
+	ie.enqueue(corrections...)
+}
+
+// wasCorrected reports whether a reconcile already queued the change of the informer's event. The correction is
+// forgotten once the informer delivers an event of the object
+func (ie *informerEvents) wasCorrected(eventType watch.EventType, obj runtime.Object) bool {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		return false
+	}
+	ie.queueMutex.Lock()
+	defer ie.queueMutex.Unlock()
+	correction, ok := ie.corrected[key]
+	if !ok {
+		return false
+	}
+	delete(ie.corrected, key)
+	deleted := eventType == watch.Deleted
+	return deleted == (correction.Type == watch.Deleted) && !isNewer(resourceVersion(obj), resourceVersion(correction.Object))
+}
+
+// fillReady moves the first queued event to ready once the watcher took the previous one, queueMutex must be held
+func (ie *informerEvents) fillReady() {
+	if len(ie.ready) == 0 && len(ie.queued) > 0 {
+		ie.ready <- ie.queued[0]
+		ie.queued = ie.queued[1:]
+	}
+}
+
+// replay queues every object the informer holds as added, so the next first report lists all of them. It runs in the
+// watcher's goroutine, the objects are handled before the informer's next event and replace the events queued before
+func (ie *informerEvents) replay() {
+	objects := ie.informer.GetStore().List()
+	events := make([]watch.Event, 0, len(objects))
+	for _, obj := range objects {
+		if object, ok := obj.(runtime.Object); ok {
+			events = append(events, watch.Event{Type: watch.Added, Object: object.DeepCopyObject()})
+		}
+	}
+	ie.queueMutex.Lock()
+	defer ie.queueMutex.Unlock()
+	select {
+	case <-ie.ready:
+	default:
+	}
+	ie.queued = events
+	ie.fillReady()
+}
+
+// WarmCaches starts the informers of every watcher without reporting their events, so a standby replica can take over
+// the reporting without listing the cluster first
+func (wh *WatchHandler) WarmCaches(ctx context.Context) {
+	informers := map[string]func() cache.SharedIndexInformer{
+		"pods":                   wh.informerFactory.Core().V1().Pods().Informer,
+		"nodes":                  wh.informerFactory.Core().V1().Nodes().Informer,
+		"services":               wh.informerFactory.Core().V1().Services().Informer,
+		"secrets":                wh.informerFactory.Core().V1().Secrets().Informer,
+		"namespaces":             wh.informerFactory.Core().V1().Namespaces().Informer,
+		"cronjobs":               wh.informerFactory.Batch().V1().CronJobs().Informer,
+		"ingresses":              wh.informerFactory.Networking().V1().Ingresses().Informer,
+		"ingressclasses":         wh.informerFactory.Networking().V1().IngressClasses().Informer,
+		"networkpolicies":        wh.informerFactory.Networking().V1().NetworkPolicies().Informer,
+		"roles":                  wh.informerFactory.Rbac().V1().Roles().Informer,
+		"clusterroles":           wh.informerFactory.Rbac().V1().ClusterRoles().Informer,
+		"rolebindings":           wh.informerFactory.Rbac().V1().RoleBindings().Informer,
+		"clusterrolebindings":    wh.informerFactory.Rbac().V1().ClusterRoleBindings().Informer,
+		"serviceaccounts":        wh.informerFactory.Core().V1().ServiceAccounts().Informer,
+		"persistentvolumes":      wh.informerFactory.Core().V1().PersistentVolumes().Informer,
+		"persistentvolumeclaims": wh.informerFactory.Core().V1().PersistentVolumeClaims().Informer,
+		"storageclasses":         wh.informerFactory.Storage().V1().StorageClasses().Informer,
+	}
+	for _, gvr := range wh.dynamicResources {
+		// ForResource adds the informer to the factory, which starts it even when its watcher is disabled
+		gvr := gvr
+		informers[gvr.String()] = func() cache.SharedIndexInformer {
+			return wh.dynamicInformerFactory.ForResource(gvr).Informer()
+		}
+	}
+	for _, resource := range wh.watchedResources() {
+		wh.startInformer(ctx, resource, informers[resource](), false)
+	}
+}
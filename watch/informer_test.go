@@ -0,0 +1,149 @@
+package watch
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	core "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+func nextEvent(t *testing.T, events <-chan watch.Event) watch.Event {
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(3 * time.Second):
+		t.Fatal("no event received")
+	}
+	return watch.Event{}
+}
+
+// startInformers starts the factory and waits until the informers synced, they stop when the test ends
+func startInformers(t *testing.T, factory informers.SharedInformerFactory, synced ...cache.SharedIndexInformer) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	factory.Start(ctx.Done())
+	for _, informer := range synced {
+		if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+			t.Fatal("informer did not sync")
+		}
+	}
+}
+
+func TestWatchInformer(t *testing.T) {
+	client := fake.NewSimpleClientset(&core.Node{ObjectMeta: metav1.ObjectMeta{Name: "existing"}})
+	wh := &WatchHandler{informerFactory: newInformerFactory(client), informers: make(map[string]*informerEvents)}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	nodes := wh.watchInformer(ctx, "nodes", wh.informerFactory.Core().V1().Nodes().Informer())
+	assert.Same(t, nodes, wh.watchInformer(ctx, "nodes", wh.informerFactory.Core().V1().Nodes().Informer()))
+
+	// the initial list reports the objects that existed before the watch started
+	event := nextEvent(t, nodes.events)
+	assert.Equal(t, watch.Added, event.Type)
+	assert.Equal(t, "existing", event.Object.(*core.Node).Name)
+
+	_, err := client.CoreV1().Nodes().Create(ctx, &core.Node{ObjectMeta: metav1.ObjectMeta{Name: "new"}}, metav1.CreateOptions{})
+	assert.NoError(t, err)
+	event = nextEvent(t, nodes.events)
+	assert.Equal(t, watch.Added, event.Type)
+	assert.Equal(t, "new", event.Object.(*core.Node).Name)
+
+	// the handlers get copies they may modify
+	event.Object.(*core.Node).Labels = map[string]string{"modified": "true"}
+	cached, _, _ := nodes.informer.GetStore().GetByKey("new")
+	assert.Empty(t, cached.(*core.Node).Labels)
+
+	assert.NoError(t, client.CoreV1().Nodes().Delete(ctx, "existing", metav1.DeleteOptions{}))
+	event = nextEvent(t, nodes.events)
+	assert.Equal(t, watch.Deleted, event.Type)
+	assert.Equal(t, "existing", event.Object.(*core.Node).Name)
+
+	nodes.replay()
+	event = nextEvent(t, nodes.next())
+	assert.Equal(t, watch.Added, event.Type)
+	assert.Equal(t, "new", event.Object.(*core.Node).Name)
+}
+
+func TestReplayBeforeLiveEvents(t *testing.T) {
+	informer := newInformerFactory(fake.NewSimpleClientset()).Core().V1().Nodes().Informer()
+	for _, name := range []string{"first", "second"} {
+		assert.NoError(t, informer.GetStore().Add(&core.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}))
+	}
+	nodes := newInformerEvents("nodes", informer, nil)
+	nodes.reporting.Store(true)
+	go nodes.onDelete(&core.Node{ObjectMeta: metav1.ObjectMeta{Name: "first"}})
+
+	// the replayed objects are handled before the live events that wait meanwhile
+	nodes.replay()
+	replayed := []string{}
+	for i := 0; i < 2; i++ {
+		event := nextEvent(t, nodes.next())
+		assert.Equal(t, watch.Added, event.Type)
+		replayed = append(replayed, event.Object.(*core.Node).Name)
+	}
+	assert.ElementsMatch(t, []string{"first", "second"}, replayed)
+	event := nextEvent(t, nodes.next())
+	assert.Equal(t, watch.Deleted, event.Type)
+	assert.Equal(t, "first", event.Object.(*core.Node).Name)
+}
+
+func TestInformerEventsRelist(t *testing.T) {
+	ie := &informerEvents{name: "nodes", events: make(chan watch.Event, 3)}
+	ie.reporting.Store(true)
+	unchanged := &core.Node{ObjectMeta: metav1.ObjectMeta{Name: "unchanged", ResourceVersion: "1"}}
+	changed := &core.Node{ObjectMeta: metav1.ObjectMeta{Name: "changed", ResourceVersion: "2"}}
+
+	// the relist delivers the unchanged objects as updates too
+	ie.onUpdate(unchanged, unchanged.DeepCopy())
+	ie.onUpdate(&core.Node{ObjectMeta: metav1.ObjectMeta{Name: "changed", ResourceVersion: "1"}}, changed)
+	ie.onDelete(cache.DeletedFinalStateUnknown{Key: "gone", Obj: &core.Node{ObjectMeta: metav1.ObjectMeta{Name: "gone"}}})
+
+	event := <-ie.events
+	assert.Equal(t, watch.Modified, event.Type)
+	assert.Equal(t, "changed", event.Object.(*core.Node).Name)
+	event = <-ie.events
+	assert.Equal(t, watch.Deleted, event.Type)
+	assert.Equal(t, "gone", event.Object.(*core.Node).Name)
+	assert.Len(t, ie.events, 0)
+}
+
+func TestWarmInformerReplaysOnTakeover(t *testing.T) {
+	client := fake.NewSimpleClientset(&core.Node{ObjectMeta: metav1.ObjectMeta{Name: "existing"}})
+	wh := &WatchHandler{informerFactory: newInformerFactory(client), informers: make(map[string]*informerEvents)}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// a standby keeps the cache warm without reporting
+	standby := wh.startInformer(ctx, "nodes", wh.informerFactory.Core().V1().Nodes().Informer(), false)
+	assert.Eventually(t, standby.informer.HasSynced, 3*time.Second, 10*time.Millisecond)
+	select {
+	case event := <-standby.events:
+		t.Fatalf("standby reported %v", event)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// the new leader reports everything the cache holds
+	leader := wh.watchInformer(ctx, "nodes", wh.informerFactory.Core().V1().Nodes().Informer())
+	assert.Same(t, standby, leader)
+	event := nextEvent(t, leader.next())
+	assert.Equal(t, watch.Added, event.Type)
+	assert.Equal(t, "existing", event.Object.(*core.Node).Name)
+}
+
+func TestInformerEventsWatchErrors(t *testing.T) {
+	ie := &informerEvents{name: "nodes", status: &watcherStatus{}}
+	// an expired or closed watch is resumed by the informer and does not fail the watcher
+	ie.onWatchError(nil, apierrors.NewResourceExpired("too old resource version"))
+	ie.onWatchError(nil, io.EOF)
+	assert.Empty(t, ie.status.health("nodes").LastError)
+}
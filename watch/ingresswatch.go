@@ -0,0 +1,264 @@
+package watch
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"time"
+
+	logger "github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+	"golang.org/x/net/context"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+const (
+	ingressClassAnnotation        = "kubernetes.io/ingress.class"
+	defaultIngressClassAnnotation = "ingressclass.kubernetes.io/is-default-class"
+)
+
+// ingressData is an ingress of the report, with the services, TLS secrets and host rules it routes to
+type ingressData struct {
+	*networkingv1.Ingress `json:",inline"`
+	ClassName             string            `json:"ingressClass,omitempty"`
+	BackendServices       []string          `json:"backendServices,omitempty"`
+	TLSSecrets            []string          `json:"tlsSecrets,omitempty"`
+	HostRules             []ingressHostRule `json:"hostRules,omitempty"`
+}
+
+type ingressHostRule struct {
+	Host  string        `json:"host,omitempty"`
+	Paths []ingressPath `json:"paths"`
+}
+
+type ingressPath struct {
+	Path     string `json:"path,omitempty"`
+	PathType string `json:"pathType,omitempty"`
+	Service  string `json:"service,omitempty"`
+	Port     string `json:"port,omitempty"`
+}
+
+// ingressClassData is an ingress class of the report
+type ingressClassData struct {
+	*networkingv1.IngressClass `json:",inline"`
+	IsDefault                  bool `json:"isDefault"`
+}
+
+func newIngressData(ingress *networkingv1.Ingress) ingressData {
+	data := ingressData{Ingress: ingress, ClassName: ingress.Annotations[ingressClassAnnotation]}
+	if ingress.Spec.IngressClassName != nil {
+		data.ClassName = *ingress.Spec.IngressClassName
+	}
+	services := map[string]bool{}
+	if backend := ingress.Spec.DefaultBackend; backend != nil && backend.Service != nil {
+		services[backend.Service.Name] = true
+	}
+	for _, rule := range ingress.Spec.Rules {
+		hostRule := ingressHostRule{Host: rule.Host, Paths: []ingressPath{}}
+		if rule.HTTP != nil {
+			for _, path := range rule.HTTP.Paths {
+				p := ingressPath{Path: path.Path}
+				if path.PathType != nil {
+					p.PathType = string(*path.PathType)
+				}
+				if path.Backend.Service != nil {
+					p.Service = path.Backend.Service.Name
+					p.Port = ingressServicePort(path.Backend.Service.Port)
+					services[path.Backend.Service.Name] = true
+				}
+				hostRule.Paths = append(hostRule.Paths, p)
+			}
+		}
+		data.HostRules = append(data.HostRules, hostRule)
+	}
+	for service := range services {
+		data.BackendServices = append(data.BackendServices, service)
+	}
+	sort.Strings(data.BackendServices)
+	secrets := map[string]bool{}
+	for _, tls := range ingress.Spec.TLS {
+		if tls.SecretName != "" && !secrets[tls.SecretName] {
+			secrets[tls.SecretName] = true
+			data.TLSSecrets = append(data.TLSSecrets, tls.SecretName)
+		}
+	}
+	return data
+}
+
+func ingressServicePort(port networkingv1.ServiceBackendPort) string {
+	if port.Name != "" {
+		return port.Name
+	}
+	return fmt.Sprintf("%d", port.Number)
+}
+
+func newIngressClassData(ingressClass *networkingv1.IngressClass) ingressClassData {
+	return ingressClassData{IngressClass: ingressClass, IsDefault: ingressClass.Annotations[defaultIngressClassAnnotation] == "true"}
+}
+
+// IngressWatch watch over ingresses
+func (wh *WatchHandler) IngressWatch(ctx context.Context) {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.L().Ctx(ctx).Error("RECOVER IngressWatch", helpers.Interface("error", err), helpers.String("stack", string(debug.Stack())))
+		}
+	}()
+	newStateChan, unregister := wh.registerNewStateChan()
+	defer unregister()
+	logger.L().Info("Watching over ingresses starting")
+	ingresses := wh.watchInformer(ctx, "ingresses", wh.informerFactory.Networking().V1().Ingresses().Informer())
+	reconcile, stopReconcile := newReconcileTicker()
+	defer stopReconcile()
+	for {
+		wh.handleIngressWatch(ctx, ingresses, newStateChan, reconcile)
+		if ctx.Err() != nil {
+			return
+		}
+		// the new first report starts from an empty state and reports every existing object again
+		wh.ingressdm = newResourceMap()
+		ingresses.replay()
+	}
+}
+
+func (wh *WatchHandler) handleIngressWatch(ctx context.Context, events *informerEvents, newStateChan <-chan bool, reconcile <-chan time.Time) {
+	logger.L().Info("Watching over ingresses started")
+	for {
+		var event watch.Event
+		select {
+		case event = <-events.next():
+		case <-newStateChan:
+			return
+		case <-events.done(ctx):
+			if events.stop() {
+				continue
+			}
+			return
+		case <-reconcile:
+			wh.reconcileIngresses(ctx, events)
+			continue
+		}
+		ingress, ok := event.Object.(*networkingv1.Ingress)
+		if !ok {
+			logger.L().Ctx(ctx).Error("failed to handle ingress event", helpers.Error(fmt.Errorf("got unexpected ingress from chan")))
+			continue
+		}
+		if !wh.isNamespaceWatched(ingress.Namespace) {
+			continue
+		}
+		ingress.ManagedFields = []metav1.ManagedFieldsEntry{}
+		data := newIngressData(ingress)
+		switch event.Type {
+		case watch.Added:
+			id := CreateID()
+			wh.ingressdm.init(id)
+			wh.ingressdm.pushBack(id, data)
+			informNewDataArrive(wh)
+			wh.jsonReport.AddToJsonFormat(data, INGRESSES, CREATED)
+		case watch.Modified:
+			if id, found := wh.findIngress(ingress.Namespace, ingress.Name); found {
+				wh.ingressdm.updateFront(id, data)
+			}
+			informNewDataArrive(wh)
+			wh.jsonReport.AddToJsonFormat(data, INGRESSES, UPDATED)
+		case watch.Deleted:
+			if id, found := wh.findIngress(ingress.Namespace, ingress.Name); found {
+				wh.ingressdm.remove(id)
+			}
+			informNewDataArrive(wh)
+			wh.jsonReport.AddToJsonFormat(data, INGRESSES, DELETED)
+		}
+	}
+}
+
+// findIngress returns the id of the ingress in the ingresses list
+func (wh *WatchHandler) findIngress(namespace, name string) (int, bool) {
+	for _, id := range wh.ingressdm.getIDs() {
+		front := wh.ingressdm.front(id)
+		if front == nil || front.Value == nil {
+			continue
+		}
+		if data, ok := front.Value.(ingressData); ok && data.Namespace == namespace && data.Name == name {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// reconcileIngresses corrects the ingresses the watch stream missed
+func (wh *WatchHandler) reconcileIngresses(ctx context.Context, events *informerEvents) {
+	reported := wh.ingressdm.reportedVersions(func(value interface{}) metav1.Object {
+		if data, ok := value.(ingressData); ok && data.Ingress != nil {
+			return data.Ingress
+		}
+		return nil
+	})
+	ingresses, err := wh.RestAPIClient.NetworkingV1().Ingresses("").List(ctx, listOptions("ingresses"))
+	if err != nil {
+		logger.L().Ctx(ctx).Error("failed to list ingresses for reconcile", helpers.Error(err))
+		return
+	}
+	listed := make([]runtime.Object, 0, len(ingresses.Items))
+	for i := range ingresses.Items {
+		listed = append(listed, &ingresses.Items[i])
+	}
+	wh.reconcile(ctx, events, reported, listed, wh.isObjectNamespaceWatched)
+}
+
+// IngressClassWatch watch over ingress classes
+func (wh *WatchHandler) IngressClassWatch(ctx context.Context) {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.L().Ctx(ctx).Error("RECOVER IngressClassWatch", helpers.Interface("error", err), helpers.String("stack", string(debug.Stack())))
+		}
+	}()
+	newStateChan, unregister := wh.registerNewStateChan()
+	defer unregister()
+	logger.L().Info("Watching over ingress classes starting")
+	ingressClasses := wh.watchInformer(ctx, "ingressclasses", wh.informerFactory.Networking().V1().IngressClasses().Informer())
+	for {
+		wh.handleIngressClassWatch(ctx, ingressClasses, newStateChan)
+		if ctx.Err() != nil {
+			return
+		}
+		// report every existing object again in the new first report
+		ingressClasses.replay()
+	}
+}
+
+func (wh *WatchHandler) handleIngressClassWatch(ctx context.Context, events *informerEvents, newStateChan <-chan bool) {
+	logger.L().Info("Watching over ingress classes started")
+	for {
+		var event watch.Event
+		select {
+		case event = <-events.next():
+		case <-newStateChan:
+			return
+		case <-events.done(ctx):
+			if events.stop() {
+				continue
+			}
+			return
+		}
+		ingressClass, ok := event.Object.(*networkingv1.IngressClass)
+		if !ok {
+			logger.L().Ctx(ctx).Error("failed to handle ingress class event", helpers.Error(fmt.Errorf("got unexpected ingress class from chan")))
+			continue
+		}
+		ingressClass.ManagedFields = []metav1.ManagedFieldsEntry{}
+		data := newIngressClassData(ingressClass)
+		switch event.Type {
+		case watch.Added:
+			informNewDataArrive(wh)
+			wh.jsonReport.AddToJsonFormat(data, INGRESSCLASSES, CREATED)
+		case watch.Modified:
+			informNewDataArrive(wh)
+			wh.jsonReport.AddToJsonFormat(data, INGRESSCLASSES, UPDATED)
+		case watch.Deleted:
+			informNewDataArrive(wh)
+			wh.jsonReport.AddToJsonFormat(data, INGRESSCLASSES, DELETED)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package watch
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func TestNewIngressData(t *testing.T) {
+	prefix := networkingv1.PathTypePrefix
+	className := "nginx"
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "web"},
+		Spec: networkingv1.IngressSpec{
+			IngressClassName: &className,
+			DefaultBackend:   &networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{Name: "fallback", Port: networkingv1.ServiceBackendPort{Number: 80}}},
+			TLS:              []networkingv1.IngressTLS{{Hosts: []string{"shop.example.com"}, SecretName: "shop-tls"}, {Hosts: []string{"api.example.com"}, SecretName: "shop-tls"}},
+			Rules: []networkingv1.IngressRule{{
+				Host: "shop.example.com",
+				IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{Paths: []networkingv1.HTTPIngressPath{
+					{Path: "/", PathType: &prefix, Backend: networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{Name: "frontend", Port: networkingv1.ServiceBackendPort{Name: "http"}}}},
+					{Path: "/api", PathType: &prefix, Backend: networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{Name: "api", Port: networkingv1.ServiceBackendPort{Number: 8080}}}},
+				}}},
+			}},
+		},
+	}
+
+	data := newIngressData(ingress)
+	assert.Equal(t, "nginx", data.ClassName)
+	assert.Equal(t, []string{"api", "fallback", "frontend"}, data.BackendServices)
+	assert.Equal(t, []string{"shop-tls"}, data.TLSSecrets)
+	assert.Equal(t, []ingressHostRule{{Host: "shop.example.com", Paths: []ingressPath{
+		{Path: "/", PathType: "Prefix", Service: "frontend", Port: "http"},
+		{Path: "/api", PathType: "Prefix", Service: "api", Port: "8080"},
+	}}}, data.HostRules)
+}
+
+func TestHandleIngressWatch(t *testing.T) {
+	wh := &WatchHandler{
+		informNewDataChannel:    make(chan int, 10),
+		includeNamespaces:       []string{""},
+		clusterAPIServerVersion: &version.Info{},
+		ingressdm:               newResourceMap(),
+	}
+	ingress := func(name string) *networkingv1.Ingress {
+		return &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: name}}
+	}
+	events := newInformerEvents("ingresses", nil, nil)
+	newStateChan := make(chan bool)
+	done := make(chan struct{})
+	go func() {
+		wh.handleIngressWatch(context.Background(), events, newStateChan, nil)
+		close(done)
+	}()
+	events.events <- watch.Event{Type: watch.Added, Object: ingress("web")}
+	events.events <- watch.Event{Type: watch.Added, Object: ingress("api")}
+	events.events <- watch.Event{Type: watch.Modified, Object: ingress("web")}
+	events.events <- watch.Event{Type: watch.Deleted, Object: ingress("api")}
+	newStateChan <- true
+	<-done
+
+	assert.Equal(t, 2, len(wh.jsonReport.Ingresses.Created))
+	assert.Equal(t, 1, len(wh.jsonReport.Ingresses.Updated))
+	assert.Equal(t, 1, len(wh.jsonReport.Ingresses.Deleted))
+	_, found := wh.findIngress("shop", "web")
+	assert.True(t, found)
+	_, found = wh.findIngress("shop", "api")
+	assert.False(t, found)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 
+	"github.com/google/uuid"
 	logger "github.com/kubescape/go-logger"
 	"github.com/kubescape/go-logger/helpers"
 	"k8s.io/apimachinery/pkg/version"
@@ -13,12 +14,23 @@ type JsonType int
 type StateType int
 
 const (
-	NODE          JsonType = 1
-	SERVICES      JsonType = 2
-	MICROSERVICES JsonType = 3
-	PODS          JsonType = 4
-	SECRETS       JsonType = 5
-	NAMESPACES    JsonType = 6
+	NODE                   JsonType = 1
+	SERVICES               JsonType = 2
+	MICROSERVICES          JsonType = 3
+	PODS                   JsonType = 4
+	SECRETS                JsonType = 5
+	NAMESPACES             JsonType = 6
+	INGRESSES              JsonType = 7
+	INGRESSCLASSES         JsonType = 8
+	NETWORKPOLICIES        JsonType = 9
+	ROLES                  JsonType = 10
+	CLUSTERROLES           JsonType = 11
+	ROLEBINDINGS           JsonType = 12
+	CLUSTERROLEBINDINGS    JsonType = 13
+	SERVICEACCOUNTS        JsonType = 14
+	PERSISTENTVOLUMES      JsonType = 15
+	PERSISTENTVOLUMECLAIMS JsonType = 16
+	STORAGECLASSES         JsonType = 17
 )
 
 const (
@@ -40,14 +52,30 @@ type ObjectData struct {
 
 type jsonFormat struct {
 	FirstReport             bool          `json:"firstReport"`
+	SequenceNumber          uint64        `json:"sequenceNumber,omitempty"`
+	ReportID                string        `json:"reportID,omitempty"`
 	ClusterAPIServerVersion *version.Info `json:"clusterAPIServerVersion,omitempty"`
 	CloudVendor             string        `json:"cloudVendor,omitempty"`
+	Capabilities            *capabilities `json:"capabilities,omitempty"`
 	Nodes                   *ObjectData   `json:"node,omitempty"`
 	Services                *ObjectData   `json:"service,omitempty"`
 	MicroServices           *ObjectData   `json:"microservice,omitempty"`
 	Pods                    *ObjectData   `json:"pod,omitempty"`
 	Secret                  *ObjectData   `json:"secret,omitempty"`
 	Namespace               *ObjectData   `json:"namespace,omitempty"`
+	Ingresses               *ObjectData   `json:"ingress,omitempty"`
+	IngressClasses          *ObjectData   `json:"ingressClass,omitempty"`
+	NetworkPolicies         *ObjectData   `json:"networkPolicy,omitempty"`
+	Roles                   *ObjectData   `json:"role,omitempty"`
+	ClusterRoles            *ObjectData   `json:"clusterRole,omitempty"`
+	RoleBindings            *ObjectData   `json:"roleBinding,omitempty"`
+	ClusterRoleBindings     *ObjectData   `json:"clusterRoleBinding,omitempty"`
+	ServiceAccounts         *ObjectData   `json:"serviceAccount,omitempty"`
+	PersistentVolumes       *ObjectData   `json:"persistentVolume,omitempty"`
+	PersistentVolumeClaims  *ObjectData   `json:"persistentVolumeClaim,omitempty"`
+	StorageClasses          *ObjectData   `json:"storageClass,omitempty"`
+	// Resources holds the objects of the WATCH_RESOURCES resources, keyed by group/version/kind
+	Resources map[string]*ObjectData `json:"resources,omitempty"`
 }
 
 func (obj *ObjectData) AddToJsonFormatByState(NewData interface{}, stype StateType) {
@@ -110,10 +138,76 @@ func (jsonReport *jsonFormat) AddToJsonFormat(data interface{}, jtype JsonType,
 			jsonReport.Namespace = &ObjectData{}
 		}
 		jsonReport.Namespace.AddToJsonFormatByState(data, stype)
+	case INGRESSES:
+		if jsonReport.Ingresses == nil {
+			jsonReport.Ingresses = &ObjectData{}
+		}
+		jsonReport.Ingresses.AddToJsonFormatByState(data, stype)
+	case INGRESSCLASSES:
+		if jsonReport.IngressClasses == nil {
+			jsonReport.IngressClasses = &ObjectData{}
+		}
+		jsonReport.IngressClasses.AddToJsonFormatByState(data, stype)
+	case NETWORKPOLICIES:
+		if jsonReport.NetworkPolicies == nil {
+			jsonReport.NetworkPolicies = &ObjectData{}
+		}
+		jsonReport.NetworkPolicies.AddToJsonFormatByState(data, stype)
+	case ROLES:
+		if jsonReport.Roles == nil {
+			jsonReport.Roles = &ObjectData{}
+		}
+		jsonReport.Roles.AddToJsonFormatByState(data, stype)
+	case CLUSTERROLES:
+		if jsonReport.ClusterRoles == nil {
+			jsonReport.ClusterRoles = &ObjectData{}
+		}
+		jsonReport.ClusterRoles.AddToJsonFormatByState(data, stype)
+	case ROLEBINDINGS:
+		if jsonReport.RoleBindings == nil {
+			jsonReport.RoleBindings = &ObjectData{}
+		}
+		jsonReport.RoleBindings.AddToJsonFormatByState(data, stype)
+	case CLUSTERROLEBINDINGS:
+		if jsonReport.ClusterRoleBindings == nil {
+			jsonReport.ClusterRoleBindings = &ObjectData{}
+		}
+		jsonReport.ClusterRoleBindings.AddToJsonFormatByState(data, stype)
+	case SERVICEACCOUNTS:
+		if jsonReport.ServiceAccounts == nil {
+			jsonReport.ServiceAccounts = &ObjectData{}
+		}
+		jsonReport.ServiceAccounts.AddToJsonFormatByState(data, stype)
+	case PERSISTENTVOLUMES:
+		if jsonReport.PersistentVolumes == nil {
+			jsonReport.PersistentVolumes = &ObjectData{}
+		}
+		jsonReport.PersistentVolumes.AddToJsonFormatByState(data, stype)
+	case PERSISTENTVOLUMECLAIMS:
+		if jsonReport.PersistentVolumeClaims == nil {
+			jsonReport.PersistentVolumeClaims = &ObjectData{}
+		}
+		jsonReport.PersistentVolumeClaims.AddToJsonFormatByState(data, stype)
+	case STORAGECLASSES:
+		if jsonReport.StorageClasses == nil {
+			jsonReport.StorageClasses = &ObjectData{}
+		}
+		jsonReport.StorageClasses.AddToJsonFormatByState(data, stype)
 	}
 
 }
 
+// AddResource adds an object of a dynamically watched resource to its section of the report
+func (jsonReport *jsonFormat) AddResource(data interface{}, key string, stype StateType) {
+	if jsonReport.Resources == nil {
+		jsonReport.Resources = map[string]*ObjectData{}
+	}
+	if jsonReport.Resources[key] == nil {
+		jsonReport.Resources[key] = &ObjectData{}
+	}
+	jsonReport.Resources[key].AddToJsonFormatByState(data, stype)
+}
+
 func prepareDataToSend(ctx context.Context, wh *WatchHandler) []byte {
 	jsonReport := wh.jsonReport
 	if wh.clusterAPIServerVersion == nil {
@@ -122,9 +216,11 @@ func prepareDataToSend(ctx context.Context, wh *WatchHandler) []byte {
 	if *wh.getAggregateFirstDataFlag() {
 		jsonReport.ClusterAPIServerVersion = wh.clusterAPIServerVersion
 		jsonReport.CloudVendor = wh.cloudVendor
+		jsonReport.Capabilities = wh.capabilities
 	} else {
 		jsonReport.ClusterAPIServerVersion = nil
 		jsonReport.CloudVendor = ""
+		jsonReport.Capabilities = nil
 	}
 	if jsonReport.Nodes.Len() == 0 {
 		jsonReport.Nodes = nil
@@ -144,6 +240,46 @@ func prepareDataToSend(ctx context.Context, wh *WatchHandler) []byte {
 	if jsonReport.Namespace.Len() == 0 {
 		jsonReport.Namespace = nil
 	}
+	if jsonReport.Ingresses.Len() == 0 {
+		jsonReport.Ingresses = nil
+	}
+	if jsonReport.IngressClasses.Len() == 0 {
+		jsonReport.IngressClasses = nil
+	}
+	if jsonReport.NetworkPolicies.Len() == 0 {
+		jsonReport.NetworkPolicies = nil
+	}
+	if jsonReport.Roles.Len() == 0 {
+		jsonReport.Roles = nil
+	}
+	if jsonReport.ClusterRoles.Len() == 0 {
+		jsonReport.ClusterRoles = nil
+	}
+	if jsonReport.RoleBindings.Len() == 0 {
+		jsonReport.RoleBindings = nil
+	}
+	if jsonReport.ClusterRoleBindings.Len() == 0 {
+		jsonReport.ClusterRoleBindings = nil
+	}
+	if jsonReport.ServiceAccounts.Len() == 0 {
+		jsonReport.ServiceAccounts = nil
+	}
+	if jsonReport.PersistentVolumes.Len() == 0 {
+		jsonReport.PersistentVolumes = nil
+	}
+	if jsonReport.PersistentVolumeClaims.Len() == 0 {
+		jsonReport.PersistentVolumeClaims = nil
+	}
+	if jsonReport.StorageClasses.Len() == 0 {
+		jsonReport.StorageClasses = nil
+	}
+	jsonReport.Resources = wh.takeResources()
+	if !jsonReport.FirstReport || !jsonReport.isEmpty() {
+		// every report that is going to be sent gets its own sequence number, so the backend can acknowledge it
+		wh.reportSequence++
+		jsonReport.SequenceNumber = wh.reportSequence
+		jsonReport.ReportID = uuid.NewString()
+	}
 	jsonReportToSend, err := json.Marshal(jsonReport)
 	if nil != err {
 		logger.L().Ctx(ctx).Error("In PrepareDataToSend json.Marshal", helpers.Error(err))
@@ -156,6 +292,71 @@ func prepareDataToSend(ctx context.Context, wh *WatchHandler) []byte {
 	return jsonReportToSend
 }
 
+// isEmpty reports whether the report carries no data besides the first report flag
+func (jsonReport *jsonFormat) isEmpty() bool {
+	return jsonReport.ClusterAPIServerVersion == nil && jsonReport.CloudVendor == "" && jsonReport.Capabilities == nil &&
+		jsonReport.Nodes == nil && jsonReport.Services == nil && jsonReport.MicroServices == nil &&
+		jsonReport.Pods == nil && jsonReport.Secret == nil && jsonReport.Namespace == nil &&
+		jsonReport.Ingresses == nil && jsonReport.IngressClasses == nil && jsonReport.NetworkPolicies == nil &&
+		jsonReport.Roles == nil && jsonReport.ClusterRoles == nil && jsonReport.RoleBindings == nil && jsonReport.ClusterRoleBindings == nil &&
+		jsonReport.ServiceAccounts == nil && jsonReport.PersistentVolumes == nil && jsonReport.PersistentVolumeClaims == nil && jsonReport.StorageClasses == nil &&
+		jsonReport.Resources == nil
+}
+
+// pendingObjects counts the objects that were aggregated and not sent yet
+func (jsonReport *jsonFormat) pendingObjects() int {
+	pending := jsonReport.Nodes.Len() + jsonReport.Services.Len() + jsonReport.MicroServices.Len() +
+		jsonReport.Pods.Len() + jsonReport.Secret.Len() + jsonReport.Namespace.Len() +
+		jsonReport.Ingresses.Len() + jsonReport.IngressClasses.Len() + jsonReport.NetworkPolicies.Len() +
+		jsonReport.Roles.Len() + jsonReport.ClusterRoles.Len() + jsonReport.RoleBindings.Len() + jsonReport.ClusterRoleBindings.Len() +
+		jsonReport.ServiceAccounts.Len() + jsonReport.PersistentVolumes.Len() + jsonReport.PersistentVolumeClaims.Len() + jsonReport.StorageClasses.Len()
+	for _, objects := range jsonReport.Resources {
+		pending += objects.Len()
+	}
+	return pending
+}
+
+// pendingObjects counts the objects the watchers aggregated and that were not sent yet
+func (wh *WatchHandler) pendingObjects() int {
+	wh.resourcesMutex.Lock()
+	defer wh.resourcesMutex.Unlock()
+	return wh.jsonReport.pendingObjects()
+}
+
+// addResource adds an object of a dynamically watched resource to the report, every dynamic watcher calls it from
+// its own goroutine
+func (wh *WatchHandler) addResource(data interface{}, key string, stype StateType) {
+	wh.resourcesMutex.Lock()
+	defer wh.resourcesMutex.Unlock()
+	wh.jsonReport.AddResource(data, key, stype)
+}
+
+// addMicroService adds a workload to the report, the pods and the cron jobs watchers call it from their own goroutines
+func (wh *WatchHandler) addMicroService(data interface{}, stype StateType) {
+	wh.microServicesMutex.Lock()
+	defer wh.microServicesMutex.Unlock()
+	wh.jsonReport.AddToJsonFormat(data, MICROSERVICES, stype)
+}
+
+// takeResources removes the objects of the dynamically watched resources from the report and returns the sections
+// that hold objects, nil when none does
+func (wh *WatchHandler) takeResources() map[string]*ObjectData {
+	wh.resourcesMutex.Lock()
+	defer wh.resourcesMutex.Unlock()
+	var resources map[string]*ObjectData
+	for key, objects := range wh.jsonReport.Resources {
+		if objects.Len() == 0 {
+			continue
+		}
+		if resources == nil {
+			resources = map[string]*ObjectData{}
+		}
+		resources[key] = objects
+	}
+	wh.jsonReport.Resources = nil
+	return resources
+}
+
 func isEmptyFirstReport(jsonReportToSend []byte) bool {
 	// len==0 is for empty json, len==2 is for "{}"
 	if len(jsonReportToSend) == 0 || len(jsonReportToSend) == 2 || len(jsonReportToSend) == FirstReportEmptyLength {
@@ -165,15 +366,32 @@ func isEmptyFirstReport(jsonReportToSend []byte) bool {
 	return false
 }
 
-// WaitTillNewDataArrived -
-func WaitTillNewDataArrived(wh *WatchHandler) bool {
-	<-wh.informNewDataChannel
-	return true
+// WaitTillNewDataArrived waits for the watchers to aggregate new data, it returns false when ctx is done first
+func WaitTillNewDataArrived(ctx context.Context, wh *WatchHandler) bool {
+	select {
+	case <-wh.informNewDataChannel:
+		return true
+	case <-ctx.Done():
+		return false
+	}
 }
 
+// informNewDataArrive wakes the sender, the watchers do not wait while it is busy, the pending wake up makes it
+// send everything they aggregated meanwhile in one report
 func informNewDataArrive(wh *WatchHandler) {
 	if !wh.aggregateFirstDataFlag || wh.clusterAPIServerVersion != nil {
-		wh.informNewDataChannel <- 1
+		select {
+		case wh.informNewDataChannel <- 1:
+		default:
+		}
+	}
+}
+
+// wakeSender wakes the sender without waiting for the cluster info, it can be called from any goroutine
+func (wh *WatchHandler) wakeSender() {
+	select {
+	case wh.informNewDataChannel <- 1:
+	default:
 	}
 }
 
@@ -220,4 +438,70 @@ func deleteJsonData(wh *WatchHandler) {
 		deleteObjectData(&jsonReport.Namespace.Deleted)
 		deleteObjectData(&jsonReport.Namespace.Updated)
 	}
+
+	if jsonReport.Ingresses != nil {
+		deleteObjectData(&jsonReport.Ingresses.Created)
+		deleteObjectData(&jsonReport.Ingresses.Deleted)
+		deleteObjectData(&jsonReport.Ingresses.Updated)
+	}
+
+	if jsonReport.IngressClasses != nil {
+		deleteObjectData(&jsonReport.IngressClasses.Created)
+		deleteObjectData(&jsonReport.IngressClasses.Deleted)
+		deleteObjectData(&jsonReport.IngressClasses.Updated)
+	}
+
+	if jsonReport.NetworkPolicies != nil {
+		deleteObjectData(&jsonReport.NetworkPolicies.Created)
+		deleteObjectData(&jsonReport.NetworkPolicies.Deleted)
+		deleteObjectData(&jsonReport.NetworkPolicies.Updated)
+	}
+
+	if jsonReport.Roles != nil {
+		deleteObjectData(&jsonReport.Roles.Created)
+		deleteObjectData(&jsonReport.Roles.Deleted)
+		deleteObjectData(&jsonReport.Roles.Updated)
+	}
+
+	if jsonReport.ClusterRoles != nil {
+		deleteObjectData(&jsonReport.ClusterRoles.Created)
+		deleteObjectData(&jsonReport.ClusterRoles.Deleted)
+		deleteObjectData(&jsonReport.ClusterRoles.Updated)
+	}
+
+	if jsonReport.RoleBindings != nil {
+		deleteObjectData(&jsonReport.RoleBindings.Created)
+		deleteObjectData(&jsonReport.RoleBindings.Deleted)
+		deleteObjectData(&jsonReport.RoleBindings.Updated)
+	}
+
+	if jsonReport.ClusterRoleBindings != nil {
+		deleteObjectData(&jsonReport.ClusterRoleBindings.Created)
+		deleteObjectData(&jsonReport.ClusterRoleBindings.Deleted)
+		deleteObjectData(&jsonReport.ClusterRoleBindings.Updated)
+	}
+
+	if jsonReport.ServiceAccounts != nil {
+		deleteObjectData(&jsonReport.ServiceAccounts.Created)
+		deleteObjectData(&jsonReport.ServiceAccounts.Deleted)
+		deleteObjectData(&jsonReport.ServiceAccounts.Updated)
+	}
+
+	if jsonReport.PersistentVolumes != nil {
+		deleteObjectData(&jsonReport.PersistentVolumes.Created)
+		deleteObjectData(&jsonReport.PersistentVolumes.Deleted)
+		deleteObjectData(&jsonReport.PersistentVolumes.Updated)
+	}
+
+	if jsonReport.PersistentVolumeClaims != nil {
+		deleteObjectData(&jsonReport.PersistentVolumeClaims.Created)
+		deleteObjectData(&jsonReport.PersistentVolumeClaims.Deleted)
+		deleteObjectData(&jsonReport.PersistentVolumeClaims.Updated)
+	}
+
+	if jsonReport.StorageClasses != nil {
+		deleteObjectData(&jsonReport.StorageClasses.Created)
+		deleteObjectData(&jsonReport.StorageClasses.Deleted)
+		deleteObjectData(&jsonReport.StorageClasses.Updated)
+	}
 }
@@ -2,6 +2,7 @@ package watch
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"testing"
 )
@@ -38,3 +39,16 @@ func TestIsEmptyFirstReport(test *testing.T) {
 		test.Errorf("First report is not empty")
 	}
 }
+
+func TestWaitTillNewDataArrived(test *testing.T) {
+	wh := &WatchHandler{informNewDataChannel: make(chan int, 1)}
+	informNewDataArrive(wh)
+	if !WaitTillNewDataArrived(context.Background(), wh) {
+		test.Errorf("new data arrived")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if WaitTillNewDataArrived(ctx, wh) {
+		test.Errorf("shutting down")
+	}
+}
@@ -0,0 +1,94 @@
+package watch
+
+import (
+	"context"
+	"os"
+	"sync/atomic"
+	"time"
+
+	logger "github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+	"github.com/kubescape/kollector/consts"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+const (
+	LeaderElectionEnv          = "LEADER_ELECTION"
+	LeaderElectionNamespaceEnv = "LEADER_ELECTION_NAMESPACE"
+	LeaderElectionLeaseEnv     = "LEADER_ELECTION_LEASE"
+)
+
+const (
+	defaultLeaderElectionLease = "kollector"
+	leaseDuration              = 15 * time.Second
+	leaseRenewDeadline         = 10 * time.Second
+	leaseRetryPeriod           = 2 * time.Second
+)
+
+// IsLeaderElectionEnabled reports whether several kollector replicas share the reporting through a Lease
+func IsLeaderElectionEnabled() bool {
+	return os.Getenv(LeaderElectionEnv) == "true"
+}
+
+// RunAsLeader keeps the informers' caches warm and calls run once this replica acquires the Lease.
+// A replica that loses the Lease exits, its informers and report queues cannot be handed over to the new leader,
+// which starts with a first report of everything it holds. When ctx is done, RunAsLeader returns once run has
+// delivered its last reports
+func (wh *WatchHandler) RunAsLeader(ctx context.Context, isServerReady *atomic.Bool, run func(ctx context.Context)) {
+	namespace := os.Getenv(LeaderElectionNamespaceEnv)
+	if namespace == "" {
+		namespace = os.Getenv(consts.NamespaceEnvironmentVariable)
+	}
+	name := os.Getenv(LeaderElectionLeaseEnv)
+	if name == "" {
+		name = defaultLeaderElectionLease
+	}
+	identity, err := os.Hostname()
+	if err != nil {
+		logger.L().Ctx(ctx).Fatal("failed to get the leader election identity", helpers.Error(err))
+	}
+
+	wh.WarmCaches(ctx)
+	// a standby is healthy, it only waits for the Lease
+	isServerReady.Store(true)
+
+	var leading atomic.Bool
+	runDone := make(chan struct{})
+	logger.L().Ctx(ctx).Info("waiting for leadership", helpers.String("namespace", namespace), helpers.String("lease", name), helpers.String("identity", identity))
+	leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+		Lock: &resourcelock.LeaseLock{
+			LeaseMeta:  metav1.ObjectMeta{Namespace: namespace, Name: name},
+			Client:     wh.RestAPIClient.CoordinationV1(),
+			LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
+		},
+		LeaseDuration:   leaseDuration,
+		RenewDeadline:   leaseRenewDeadline,
+		RetryPeriod:     leaseRetryPeriod,
+		ReleaseOnCancel: true,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				logger.L().Ctx(ctx).Info("started leading, reporting the cluster", helpers.String("identity", identity))
+				leading.Store(true)
+				defer close(runDone)
+				run(ctx)
+			},
+			OnStoppedLeading: func() {
+				if ctx.Err() != nil {
+					if leading.Load() {
+						<-runDone
+					}
+					logger.L().Ctx(ctx).Info("released leadership", helpers.String("identity", identity))
+					return
+				}
+				logger.L().Ctx(ctx).Fatal("lost leadership, restarting as standby", helpers.String("identity", identity))
+			},
+			OnNewLeader: func(leader string) {
+				if leader != identity {
+					logger.L().Ctx(ctx).Info("another replica is leading", helpers.String("leader", leader))
+				}
+			},
+		},
+	})
+}
@@ -11,6 +11,7 @@ import (
 	"golang.org/x/net/context"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/watch"
 )
 
@@ -21,52 +22,53 @@ func (wh *WatchHandler) NamespaceWatch(ctx context.Context) {
 			logger.L().Ctx(ctx).Error("RECOVER NamespaceWatch", helpers.Interface("error", err), helpers.String("stack", string(debug.Stack())))
 		}
 	}()
-	var lastWatchEventCreationTime time.Time
-	newStateChan := make(chan bool)
-	wh.newStateReportChans = append(wh.newStateReportChans, newStateChan)
-WatchLoop:
+	newStateChan, unregister := wh.registerNewStateChan()
+	defer unregister()
+	logger.L().Info("Watching over namespaces starting")
+	namespaces := wh.watchInformer(ctx, "namespaces", wh.informerFactory.Core().V1().Namespaces().Informer())
+	reconcile, stopReconcile := newReconcileTicker()
+	defer stopReconcile()
 	for {
-		logger.L().Info("Watching over namespaces starting")
-		namespacesWatcher, err := wh.RestAPIClient.CoreV1().Namespaces().Watch(globalHTTPContext, metav1.ListOptions{Watch: true})
-		if err != nil {
-			logger.L().Ctx(ctx).Error("Failed watching over namespaces", helpers.Error(err))
-			time.Sleep(1 * time.Second)
-			continue
+		wh.handleNamespaceWatch(ctx, namespaces, newStateChan, reconcile)
+		if ctx.Err() != nil {
+			return
 		}
-		namespacesChan := namespacesWatcher.ResultChan()
-		logger.L().Info("Watching over namespaces started")
-	ChanLoop:
-		for {
-			var event watch.Event
-			select {
-			case event = <-namespacesChan:
-			case <-newStateChan:
-				namespacesWatcher.Stop()
-				continue WatchLoop
-			}
+		// the new first report starts from an empty state and reports every existing object again
+		wh.namespacedm = newResourceMap()
+		namespaces.replay()
+	}
+}
 
-			if event.Type == watch.Error {
-				logger.L().Ctx(ctx).Error("namespaces watch chan loop", helpers.Interface("error", event.Object))
-				namespacesWatcher.Stop()
-				break ChanLoop
-			}
-			if err := wh.NamespaceEventHandler(ctx, &event, lastWatchEventCreationTime); err != nil {
-				break ChanLoop
+func (wh *WatchHandler) handleNamespaceWatch(ctx context.Context, events *informerEvents, newStateChan <-chan bool, reconcile <-chan time.Time) {
+	logger.L().Info("Watching over namespaces started")
+	for {
+		var event watch.Event
+		select {
+		case event = <-events.next():
+		case <-newStateChan:
+			return
+		case <-events.done(ctx):
+			if events.stop() {
+				continue
 			}
+			return
+		case <-reconcile:
+			wh.reconcileNamespaces(ctx, events)
+			continue
+		}
+		if err := wh.NamespaceEventHandler(ctx, &event); err != nil {
+			logger.L().Ctx(ctx).Error("failed to handle namespace event", helpers.Error(err))
 		}
-		lastWatchEventCreationTime = time.Now()
-		logger.L().Debug("Watching over namespaces ended - timeout")
 	}
 }
-func (wh *WatchHandler) NamespaceEventHandler(ctx context.Context, event *watch.Event, lastWatchEventCreationTime time.Time) error {
+func (wh *WatchHandler) NamespaceEventHandler(ctx context.Context, event *watch.Event) error {
 	if namespace, ok := event.Object.(*corev1.Namespace); ok {
+		if !wh.isNamespaceNameWatched(namespace.Name) {
+			return nil
+		}
 		namespace.ManagedFields = []metav1.ManagedFieldsEntry{}
 		switch event.Type {
-		case "ADDED":
-			if namespace.CreationTimestamp.Time.Before(lastWatchEventCreationTime) {
-				logger.L().Debug("namespace already exist, will not be reported", helpers.String("name", namespace.ObjectMeta.Name))
-				return nil
-			}
+		case watch.Added:
 			id := CreateID()
 			wh.namespacedm.init(id)
 			wh.namespacedm.pushBack(id, namespace)
@@ -76,15 +78,10 @@ func (wh *WatchHandler) NamespaceEventHandler(ctx context.Context, event *watch.
 			wh.UpdateNamespace(namespace)
 			informNewDataArrive(wh)
 			wh.jsonReport.AddToJsonFormat(namespace, NAMESPACES, UPDATED)
-		case "DELETED":
+		case watch.Deleted:
 			wh.RemoveNamespace(namespace)
 			informNewDataArrive(wh)
 			wh.jsonReport.AddToJsonFormat(namespace, NAMESPACES, DELETED)
-		case "BOOKMARK": //only the resource version is changed but it's the same object
-			return nil
-		case "ERROR":
-			logger.L().Ctx(ctx).Error("while watching over namespaces", helpers.Interface("error", event.Object))
-			return fmt.Errorf("while watching over namespaces we got an error")
 		}
 	} else {
 		return fmt.Errorf("got unexpected namespace from chan")
@@ -103,10 +100,11 @@ func (wh *WatchHandler) UpdateNamespace(namespace *corev1.Namespace) {
 		if !ok {
 			continue
 		}
-		if strings.Compare(namespaceData.Name, namespaceData.Name) != 0 {
+		if strings.Compare(namespaceData.Name, namespace.Name) != 0 {
 			continue
 		}
-
+		wh.namespacedm.updateFront(id, namespace)
+		return
 	}
 }
 
@@ -134,3 +132,23 @@ func (wh *WatchHandler) RemoveNamespace(namespace *corev1.Namespace) string {
 	}
 	return ""
 }
+
+// reconcileNamespaces corrects the namespaces the watch stream missed
+func (wh *WatchHandler) reconcileNamespaces(ctx context.Context, events *informerEvents) {
+	reported := wh.namespacedm.reportedVersions(func(value interface{}) metav1.Object {
+		if namespace, ok := value.(*corev1.Namespace); ok {
+			return namespace
+		}
+		return nil
+	})
+	namespaces, err := wh.RestAPIClient.CoreV1().Namespaces().List(ctx, listOptions("namespaces"))
+	if err != nil {
+		logger.L().Ctx(ctx).Error("failed to list namespaces for reconcile", helpers.Error(err))
+		return
+	}
+	listed := make([]runtime.Object, 0, len(namespaces.Items))
+	for i := range namespaces.Items {
+		listed = append(listed, &namespaces.Items[i])
+	}
+	wh.reconcile(ctx, events, reported, listed, func(namespace metav1.Object) bool { return wh.isNamespaceNameWatched(namespace.GetName()) })
+}
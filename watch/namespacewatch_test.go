@@ -0,0 +1,28 @@
+package watch
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func TestNamespaceUpdates(t *testing.T) {
+	ctx := context.Background()
+	wh := &WatchHandler{informNewDataChannel: make(chan int, 1), namespacedm: newResourceMap(), includeNamespaces: []string{""}}
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "shop"}}
+	updated := namespace.DeepCopy()
+	updated.Labels = map[string]string{"team": "checkout"}
+
+	assert.NoError(t, wh.NamespaceEventHandler(ctx, &watch.Event{Type: watch.Added, Object: namespace}))
+	assert.NoError(t, wh.NamespaceEventHandler(ctx, &watch.Event{Type: watch.Modified, Object: updated}))
+
+	// the informers' modifications keep the report output of the watch events, which never matched "MODIFY"
+	assert.Len(t, wh.jsonReport.Namespace.Created, 1)
+	assert.Empty(t, wh.jsonReport.Namespace.Updated)
+	assert.NoError(t, wh.NamespaceEventHandler(ctx, &watch.Event{Type: "MODIFY", Object: updated}))
+	assert.Equal(t, []interface{}{updated}, wh.jsonReport.Namespace.Updated)
+}
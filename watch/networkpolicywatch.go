@@ -0,0 +1,198 @@
+package watch
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"time"
+
+	logger "github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+	"golang.org/x/net/context"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// NetworkIsolation tells which traffic of a workload the network policies restrict
+type NetworkIsolation struct {
+	IngressIsolated bool `json:"ingressIsolated"`
+	EgressIsolated  bool `json:"egressIsolated"`
+	// Unrestricted is set when no network policy selects the workload
+	Unrestricted bool     `json:"unrestricted"`
+	Policies     []string `json:"policies,omitempty"`
+}
+
+// computeNetworkIsolation matches the policies of the workload's namespace against the labels of its pod template
+func computeNetworkIsolation(policies []*networkingv1.NetworkPolicy, podLabels map[string]string) *NetworkIsolation {
+	isolation := &NetworkIsolation{}
+	for _, policy := range policies {
+		selector, err := metav1.LabelSelectorAsSelector(&policy.Spec.PodSelector)
+		if err != nil || !selector.Matches(labels.Set(podLabels)) {
+			continue
+		}
+		isolation.Policies = append(isolation.Policies, policy.Name)
+		if len(policy.Spec.PolicyTypes) == 0 {
+			// the policy types default to Ingress, and to Egress as well when the policy has egress rules
+			isolation.IngressIsolated = true
+			isolation.EgressIsolated = isolation.EgressIsolated || len(policy.Spec.Egress) > 0
+			continue
+		}
+		for _, policyType := range policy.Spec.PolicyTypes {
+			switch policyType {
+			case networkingv1.PolicyTypeIngress:
+				isolation.IngressIsolated = true
+			case networkingv1.PolicyTypeEgress:
+				isolation.EgressIsolated = true
+			}
+		}
+	}
+	sort.Strings(isolation.Policies)
+	isolation.Unrestricted = !isolation.IngressIsolated && !isolation.EgressIsolated
+	return isolation
+}
+
+// workloadPodLabels returns the labels of the workload's pod template, or the labels of the pod when the owner is unknown
+func workloadPodLabels(microService *MicroServiceData) map[string]string {
+	switch owner := microService.Owner.OwnerData.(type) {
+	case *appsv1.Deployment:
+		return owner.Spec.Template.Labels
+	case *appsv1.DaemonSet:
+		return owner.Spec.Template.Labels
+	case *appsv1.StatefulSet:
+		return owner.Spec.Template.Labels
+	case *batchv1.Job:
+		return owner.Spec.Template.Labels
+	case *batchv1.CronJob:
+		return owner.Spec.JobTemplate.Spec.Template.Labels
+	}
+	if microService.Pod == nil {
+		return nil
+	}
+	return microService.Pod.Labels
+}
+
+// networkIsolation computes the isolation of a workload from the network policies watcher's cache. It is nil when
+// the network policies are not watched
+func (wh *WatchHandler) networkIsolation(microService *MicroServiceData) *NetworkIsolation {
+	if wh.informerFactory == nil || !wh.IsWatcherEnabled("networkpolicies") || microService.Pod == nil {
+		return nil
+	}
+	policies, err := wh.informerFactory.Networking().V1().NetworkPolicies().Lister().NetworkPolicies(microService.Namespace).List(labels.Everything())
+	if err != nil {
+		return nil
+	}
+	return computeNetworkIsolation(policies, workloadPodLabels(microService))
+}
+
+// NetworkPolicyWatch watch over network policies
+func (wh *WatchHandler) NetworkPolicyWatch(ctx context.Context) {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.L().Ctx(ctx).Error("RECOVER NetworkPolicyWatch", helpers.Interface("error", err), helpers.String("stack", string(debug.Stack())))
+		}
+	}()
+	newStateChan, unregister := wh.registerNewStateChan()
+	defer unregister()
+	logger.L().Info("Watching over network policies starting")
+	policies := wh.watchInformer(ctx, "networkpolicies", wh.informerFactory.Networking().V1().NetworkPolicies().Informer())
+	reconcile, stopReconcile := newReconcileTicker()
+	defer stopReconcile()
+	for {
+		wh.handleNetworkPolicyWatch(ctx, policies, newStateChan, reconcile)
+		if ctx.Err() != nil {
+			return
+		}
+		// the new first report starts from an empty state and reports every existing object again
+		wh.networkPolicydm = newResourceMap()
+		policies.replay()
+	}
+}
+
+func (wh *WatchHandler) handleNetworkPolicyWatch(ctx context.Context, events *informerEvents, newStateChan <-chan bool, reconcile <-chan time.Time) {
+	logger.L().Info("Watching over network policies started")
+	for {
+		var event watch.Event
+		select {
+		case event = <-events.next():
+		case <-newStateChan:
+			return
+		case <-events.done(ctx):
+			if events.stop() {
+				continue
+			}
+			return
+		case <-reconcile:
+			wh.reconcileNetworkPolicies(ctx, events)
+			continue
+		}
+		policy, ok := event.Object.(*networkingv1.NetworkPolicy)
+		if !ok {
+			logger.L().Ctx(ctx).Error("failed to handle network policy event", helpers.Error(fmt.Errorf("got unexpected network policy from chan")))
+			continue
+		}
+		if !wh.isNamespaceWatched(policy.Namespace) {
+			continue
+		}
+		policy.ManagedFields = []metav1.ManagedFieldsEntry{}
+		switch event.Type {
+		case watch.Added:
+			id := CreateID()
+			wh.networkPolicydm.init(id)
+			wh.networkPolicydm.pushBack(id, policy)
+			informNewDataArrive(wh)
+			wh.jsonReport.AddToJsonFormat(policy, NETWORKPOLICIES, CREATED)
+		case watch.Modified:
+			if id, found := wh.findNetworkPolicy(policy.Namespace, policy.Name); found {
+				wh.networkPolicydm.updateFront(id, policy)
+			}
+			informNewDataArrive(wh)
+			wh.jsonReport.AddToJsonFormat(policy, NETWORKPOLICIES, UPDATED)
+		case watch.Deleted:
+			if id, found := wh.findNetworkPolicy(policy.Namespace, policy.Name); found {
+				wh.networkPolicydm.remove(id)
+			}
+			informNewDataArrive(wh)
+			wh.jsonReport.AddToJsonFormat(policy, NETWORKPOLICIES, DELETED)
+		}
+		wh.workloadsChanged(policy.Namespace)
+	}
+}
+
+// findNetworkPolicy returns the id of the network policy in the network policies list
+func (wh *WatchHandler) findNetworkPolicy(namespace, name string) (int, bool) {
+	for _, id := range wh.networkPolicydm.getIDs() {
+		front := wh.networkPolicydm.front(id)
+		if front == nil || front.Value == nil {
+			continue
+		}
+		if policy, ok := front.Value.(*networkingv1.NetworkPolicy); ok && policy.Namespace == namespace && policy.Name == name {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// reconcileNetworkPolicies corrects the network policies the watch stream missed
+func (wh *WatchHandler) reconcileNetworkPolicies(ctx context.Context, events *informerEvents) {
+	reported := wh.networkPolicydm.reportedVersions(func(value interface{}) metav1.Object {
+		if policy, ok := value.(*networkingv1.NetworkPolicy); ok {
+			return policy
+		}
+		return nil
+	})
+	policies, err := wh.RestAPIClient.NetworkingV1().NetworkPolicies("").List(ctx, listOptions("networkpolicies"))
+	if err != nil {
+		logger.L().Ctx(ctx).Error("failed to list network policies for reconcile", helpers.Error(err))
+		return
+	}
+	listed := make([]runtime.Object, 0, len(policies.Items))
+	for i := range policies.Items {
+		listed = append(listed, &policies.Items[i])
+	}
+	wh.reconcile(ctx, events, reported, listed, wh.isObjectNamespaceWatched)
+}
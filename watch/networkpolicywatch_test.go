@@ -0,0 +1,55 @@
+package watch
+
+import (
+	"container/list"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestComputeNetworkIsolation(t *testing.T) {
+	policies := []*networkingv1.NetworkPolicy{
+		{ObjectMeta: metav1.ObjectMeta{Name: "deny-ingress"}, Spec: networkingv1.NetworkPolicySpec{PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "deny-egress"}, Spec: networkingv1.NetworkPolicySpec{PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress}}},
+	}
+	assert.Equal(t, &NetworkIsolation{IngressIsolated: true, EgressIsolated: true, Policies: []string{"deny-egress", "deny-ingress"}},
+		computeNetworkIsolation(policies, map[string]string{"app": "web"}))
+	assert.Equal(t, &NetworkIsolation{EgressIsolated: true, Policies: []string{"deny-egress"}},
+		computeNetworkIsolation(policies, map[string]string{"app": "db"}))
+	assert.Equal(t, &NetworkIsolation{Unrestricted: true}, computeNetworkIsolation(policies[:1], map[string]string{"app": "db"}))
+}
+
+func TestRefreshWorkloads(t *testing.T) {
+	client := fake.NewSimpleClientset(&networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "deny-ingress"},
+		Spec:       networkingv1.NetworkPolicySpec{PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}},
+	})
+	wh := &WatchHandler{
+		informerFactory:         newInformerFactory(client),
+		informNewDataChannel:    make(chan int, 1),
+		clusterAPIServerVersion: &version.Info{},
+		pdm:                     make(map[int]*list.List),
+	}
+	deployment := &appsv1.Deployment{Spec: appsv1.DeploymentSpec{Template: core.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "web"}}}}}
+	pod := &core.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "web-1", Labels: map[string]string{"app": "web", "pod-template-hash": "1"}}}
+	microService := MicroServiceData{Pod: pod, Owner: OwnerDet{Name: "web", Kind: "Deployment", OwnerData: deployment}, PodSpecId: 1}
+	wh.pdm[1] = list.New()
+	wh.pdm[1].PushBack(microService)
+
+	startInformers(t, wh.informerFactory, wh.informerFactory.Networking().V1().NetworkPolicies().Informer())
+
+	wh.refreshWorkloads(wh.pdm, []string{"shop"})
+	isolation := wh.pdm[1].Front().Value.(MicroServiceData).NetworkIsolation
+	assert.Equal(t, &NetworkIsolation{IngressIsolated: true, Policies: []string{"deny-ingress"}}, isolation)
+	assert.Len(t, wh.jsonReport.MicroServices.Updated, 1)
+
+	// an unchanged isolation is not reported again
+	wh.refreshWorkloads(wh.pdm, []string{"shop"})
+	assert.Len(t, wh.jsonReport.MicroServices.Updated, 1)
+}
@@ -11,6 +11,7 @@ import (
 	"golang.org/x/net/context"
 	core "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/version"
 	"k8s.io/apimachinery/pkg/watch"
 )
@@ -19,11 +20,14 @@ type NodeData struct {
 	// core.NodeSystemInfo
 	core.NodeStatus `json:",inline"`
 	Name            string `json:"name"`
+	// resourceVersion is the version of the reported node, it is not reported
+	resourceVersion string
 }
 
 func (updateNode *NodeData) UpdateNodeData(node *core.Node) {
 	updateNode.Name = node.ObjectMeta.Name
 	updateNode.NodeStatus = node.Status
+	updateNode.resourceVersion = node.ResourceVersion
 }
 
 func UpdateNode(node *core.Node, ndm map[int]*list.List) *NodeData {
@@ -57,15 +61,15 @@ func RemoveNode(node *core.Node, ndm map[int]*list.List) string {
 			continue
 		}
 		if strings.Compare(v.Front().Value.(*NodeData).Name, node.ObjectMeta.Name) == 0 {
-			v.Remove(v.Front())
-			logger.L().Debug("node removed", helpers.String("name", v.Front().Value.(*NodeData).Name))
 			nodeName = v.Front().Value.(*NodeData).Name
+			v.Remove(v.Front())
+			logger.L().Debug("node removed", helpers.String("name", nodeName))
 			break
 		}
 		if strings.Compare(v.Front().Value.(*NodeData).Name, node.ObjectMeta.GenerateName) == 0 {
-			v.Remove(v.Front())
-			logger.L().Debug("node removed", helpers.String("name", v.Front().Value.(*NodeData).Name))
 			nodeName = v.Front().Value.(*NodeData).Name
+			v.Remove(v.Front())
+			logger.L().Debug("node removed", helpers.String("name", nodeName))
 			break
 		}
 	}
@@ -79,9 +83,12 @@ func (wh *WatchHandler) NodeWatch(ctx context.Context) {
 			logger.L().Ctx(ctx).Error("RECOVER NodeWatch", helpers.Interface("error", err), helpers.String("stack", string(debug.Stack())))
 		}
 	}()
-	var lastWatchEventCreationTime time.Time
-	newStateChan := make(chan bool)
-	wh.newStateReportChans = append(wh.newStateReportChans, newStateChan)
+	newStateChan, unregister := wh.registerNewStateChan()
+	defer unregister()
+	logger.L().Info("Watching over nodes starting")
+	nodes := wh.watchInformer(ctx, "nodes", wh.informerFactory.Core().V1().Nodes().Informer())
+	reconcile, stopReconcile := newReconcileTicker()
+	defer stopReconcile()
 	for {
 		wh.clusterAPIServerVersion = wh.getClusterVersion()
 		wh.cloudVendor = wh.checkInstanceMetadataAPIVendor()
@@ -89,45 +96,42 @@ func (wh *WatchHandler) NodeWatch(ctx context.Context) {
 			wh.clusterAPIServerVersion.GitVersion += ";" + wh.cloudVendor
 		}
 		logger.L().Info("K8s Cloud Vendor", helpers.String("cloudVendor", wh.cloudVendor))
-		logger.L().Info("Watching over nodes starting")
-		nodesWatcher, err := wh.RestAPIClient.CoreV1().Nodes().Watch(globalHTTPContext, metav1.ListOptions{Watch: true})
-		if err != nil {
-			time.Sleep(1 * time.Second)
-			continue
+		wh.handleNodeWatch(ctx, nodes, newStateChan, reconcile)
+		if ctx.Err() != nil {
+			return
 		}
-		wh.handleNodeWatch(nodesWatcher, newStateChan, &lastWatchEventCreationTime)
-
+		// the new first report starts from an empty state and reports every existing object again
+		wh.ndm = make(map[int]*list.List)
+		nodes.replay()
 	}
 }
-func (wh *WatchHandler) handleNodeWatch(nodesWatcher watch.Interface, newStateChan <-chan bool, lastWatchEventCreationTime *time.Time) {
-	nodesChan := nodesWatcher.ResultChan()
+func (wh *WatchHandler) handleNodeWatch(ctx context.Context, events *informerEvents, newStateChan <-chan bool, reconcile <-chan time.Time) {
 	for {
 		var event watch.Event
 		select {
-		case event = <-nodesChan:
+		case event = <-events.next():
 		case <-newStateChan:
-			nodesWatcher.Stop()
-			*lastWatchEventCreationTime = time.Now()
 			return
-		}
-		if event.Type == watch.Error {
-			nodesWatcher.Stop()
-			*lastWatchEventCreationTime = time.Now()
+		case <-events.done(ctx):
+			if events.stop() {
+				continue
+			}
 			return
+		case <-reconcile:
+			wh.reconcileNodes(ctx, events)
+			continue
 		}
 		if node, ok := event.Object.(*core.Node); ok {
 			node.ManagedFields = []metav1.ManagedFieldsEntry{}
 			switch event.Type {
-			case "ADDED":
-				if node.CreationTimestamp.Time.Before(*lastWatchEventCreationTime) {
-					continue
-				}
+			case watch.Added:
 				id := CreateID()
 				if wh.ndm[id] == nil {
 					wh.ndm[id] = list.New()
 				}
 				nd := &NodeData{Name: node.ObjectMeta.Name,
-					NodeStatus: node.Status,
+					NodeStatus:      node.Status,
+					resourceVersion: node.ResourceVersion,
 				}
 				wh.ndm[id].PushBack(nd)
 				informNewDataArrive(wh)
@@ -136,23 +140,35 @@ func (wh *WatchHandler) handleNodeWatch(nodesWatcher watch.Interface, newStateCh
 				updateNode := UpdateNode(node, wh.ndm)
 				informNewDataArrive(wh)
 				wh.jsonReport.AddToJsonFormat(updateNode, NODE, UPDATED)
-			case "DELETED":
+			case watch.Deleted:
 				name := RemoveNode(node, wh.ndm)
 				informNewDataArrive(wh)
 				wh.jsonReport.AddToJsonFormat(name, NODE, DELETED)
-			case "BOOKMARK": //only the resource version is changed but it's the same workload
-				continue
-			case "ERROR":
-				*lastWatchEventCreationTime = time.Now()
-				return
 			}
-		} else {
-			*lastWatchEventCreationTime = time.Now()
-			return
 		}
 	}
 }
 
+// reconcileNodes corrects the nodes the watch stream missed
+func (wh *WatchHandler) reconcileNodes(ctx context.Context, events *informerEvents) {
+	reported := reportedVersions(wh.ndm, func(value interface{}) metav1.Object {
+		if nd, ok := value.(*NodeData); ok {
+			return &metav1.ObjectMeta{Name: nd.Name, ResourceVersion: nd.resourceVersion}
+		}
+		return nil
+	})
+	nodes, err := wh.RestAPIClient.CoreV1().Nodes().List(ctx, listOptions("nodes"))
+	if err != nil {
+		logger.L().Ctx(ctx).Error("failed to list nodes for reconcile", helpers.Error(err))
+		return
+	}
+	listed := make([]runtime.Object, 0, len(nodes.Items))
+	for i := range nodes.Items {
+		listed = append(listed, &nodes.Items[i])
+	}
+	wh.reconcile(ctx, events, reported, listed, nil)
+}
+
 func (wh *WatchHandler) checkInstanceMetadataAPIVendor() string {
 	res, _ := getInstanceMetadata()
 	return res
@@ -0,0 +1,39 @@
+package watch
+
+import (
+	"container/list"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func TestNodeUpdates(t *testing.T) {
+	wh := &WatchHandler{informNewDataChannel: make(chan int, 1), ndm: make(map[int]*list.List)}
+	node := &core.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}}
+	node.Status.Conditions = []core.NodeCondition{{Type: core.NodeReady, Status: core.ConditionTrue}}
+	notReady := node.DeepCopy()
+	notReady.Status.Conditions[0].Status = core.ConditionFalse
+
+	nodes := newInformerEvents("nodes", nil, nil)
+	newStateChan := make(chan bool)
+	done := make(chan struct{})
+	go func() {
+		wh.handleNodeWatch(context.Background(), nodes, newStateChan, nil)
+		close(done)
+	}()
+	nodes.events <- watch.Event{Type: watch.Added, Object: node}
+	// the informers' modifications keep the report output of the watch events, which never matched "MODIFY"
+	nodes.events <- watch.Event{Type: watch.Modified, Object: notReady.DeepCopy()}
+	nodes.events <- watch.Event{Type: "MODIFY", Object: notReady}
+	newStateChan <- true
+	<-done
+
+	assert.Len(t, wh.jsonReport.Nodes.Created, 1)
+	if assert.Len(t, wh.jsonReport.Nodes.Updated, 1) {
+		assert.Equal(t, core.ConditionFalse, wh.jsonReport.Nodes.Updated[0].(*NodeData).Conditions[0].Status)
+	}
+}
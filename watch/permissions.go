@@ -0,0 +1,141 @@
+package watch
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strings"
+
+	logger "github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+	"github.com/kubescape/kollector/consts"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var (
+	watchVerbs  = []string{"list", "watch"}
+	getVerbs    = []string{"get"}
+	leaseVerbs  = []string{"get", "create", "update"}
+	ownerGroups = map[string][]string{
+		"apps":  {"deployments", "daemonsets", "statefulsets", "replicasets"},
+		"batch": {"jobs"},
+	}
+)
+
+// permission is an access kollector needs, a watcher is disabled when it lacks the permission of its resource
+type permission struct {
+	watcher   string
+	gvr       schema.GroupVersionResource
+	namespace string
+	verbs     []string
+}
+
+// capabilities is the capabilities section of the first report
+type capabilities struct {
+	Watched            []string            `json:"watched"`
+	DisabledWatchers   []string            `json:"disabledWatchers,omitempty"`
+	MissingPermissions []missingPermission `json:"missingPermissions,omitempty"`
+}
+
+type missingPermission struct {
+	Group     string   `json:"group,omitempty"`
+	Resource  string   `json:"resource"`
+	Namespace string   `json:"namespace,omitempty"`
+	Verbs     []string `json:"verbs"`
+}
+
+// requiredPermissions lists the permissions of the watchers and of the lookups of the pods' owners
+func (wh *WatchHandler) requiredPermissions() []permission {
+	permissions := []permission{}
+	for _, resource := range scopedResources {
+		gvr := schema.GroupVersionResource{Group: scopedResourceGroups[resource], Version: "v1", Resource: resource}
+		permissions = append(permissions, permission{watcher: resource, gvr: gvr, verbs: watchVerbs})
+	}
+	for _, gvr := range wh.dynamicResources {
+		permissions = append(permissions, permission{watcher: gvr.String(), gvr: gvr, verbs: watchVerbs})
+	}
+	for group, resources := range ownerGroups {
+		for _, resource := range resources {
+			permissions = append(permissions, permission{gvr: schema.GroupVersionResource{Group: group, Version: "v1", Resource: resource}, verbs: getVerbs})
+		}
+	}
+	if IsLeaderElectionEnabled() {
+		namespace := os.Getenv(LeaderElectionNamespaceEnv)
+		if namespace == "" {
+			namespace = os.Getenv(consts.NamespaceEnvironmentVariable)
+		}
+		permissions = append(permissions, permission{gvr: schema.GroupVersionResource{Group: "coordination.k8s.io", Version: "v1", Resource: "leases"}, namespace: namespace, verbs: leaseVerbs})
+	}
+	return permissions
+}
+
+// CheckPermissions asks the API server which of the required permissions the service account has. The watchers
+// that lack a permission are disabled, and the missing permissions are logged and sent in the first report
+func (wh *WatchHandler) CheckPermissions(ctx context.Context) {
+	wh.disabledWatchers = map[string]bool{}
+	missing := []missingPermission{}
+	for _, p := range wh.requiredPermissions() {
+		denied := []string{}
+		for _, verb := range p.verbs {
+			if !wh.isAllowed(ctx, p, verb) {
+				denied = append(denied, verb)
+			}
+		}
+		if len(denied) == 0 {
+			continue
+		}
+		missing = append(missing, missingPermission{Group: p.gvr.Group, Resource: p.gvr.Resource, Namespace: p.namespace, Verbs: denied})
+		if p.watcher != "" {
+			wh.disabledWatchers[p.watcher] = true
+			logger.L().Ctx(ctx).Warning("missing permission, watcher disabled", helpers.String("resource", p.gvr.GroupResource().String()), helpers.String("verbs", strings.Join(denied, ",")))
+		} else {
+			logger.L().Ctx(ctx).Warning("missing permission", helpers.String("resource", p.gvr.GroupResource().String()), helpers.String("namespace", p.namespace), helpers.String("verbs", strings.Join(denied, ",")))
+		}
+	}
+
+	disabled := []string{}
+	for watcher := range wh.disabledWatchers {
+		disabled = append(disabled, watcher)
+	}
+	sort.Strings(disabled)
+	wh.capabilities = &capabilities{Watched: wh.watchedResources(), DisabledWatchers: disabled, MissingPermissions: missing}
+	logger.L().Ctx(ctx).Info("capabilities", helpers.Interface("watched", wh.capabilities.Watched), helpers.Interface("disabledWatchers", disabled))
+
+	if wh.disabledWatchers["namespaces"] && wh.namespacesSelected {
+		logger.L().Ctx(ctx).Warning("namespaces cannot be listed, the namespace selectors are ignored")
+		wh.namespacesSelected = false
+	}
+	if wh.disabledWatchers["nodes"] {
+		// the node watcher reads the cluster info the reports wait for
+		wh.clusterAPIServerVersion = wh.getClusterVersion()
+		wh.cloudVendor = wh.checkInstanceMetadataAPIVendor()
+	}
+}
+
+// isAllowed reports whether the service account has the permission, it is assumed when the review fails
+func (wh *WatchHandler) isAllowed(ctx context.Context, p permission, verb string) bool {
+	review := &authorizationv1.SelfSubjectAccessReview{
+		Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace: p.namespace,
+				Verb:      verb,
+				Group:     p.gvr.Group,
+				Version:   p.gvr.Version,
+				Resource:  p.gvr.Resource,
+			},
+		},
+	}
+	result, err := wh.RestAPIClient.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+	if err != nil {
+		logger.L().Ctx(ctx).Warning("failed to review permission", helpers.String("resource", p.gvr.GroupResource().String()), helpers.String("verb", verb), helpers.Error(err))
+		return true
+	}
+	return result.Status.Allowed
+}
+
+// IsWatcherEnabled reports whether the service account can list and watch the resource of a watcher
+func (wh *WatchHandler) IsWatcherEnabled(resource string) bool {
+	return !wh.disabledWatchers[resource]
+}
@@ -0,0 +1,40 @@
+package watch
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestCheckPermissions(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview)
+		attributes := review.Spec.ResourceAttributes
+		review.Status.Allowed = !(attributes.Resource == "secrets" && attributes.Verb == "watch") && attributes.Resource != "jobs"
+		return true, review, nil
+	})
+	wh := &WatchHandler{RestAPIClient: client, informNewDataChannel: make(chan int, 1)}
+	wh.CheckPermissions(context.Background())
+
+	assert.False(t, wh.IsWatcherEnabled("secrets"))
+	assert.True(t, wh.IsWatcherEnabled("pods"))
+	assert.NotContains(t, wh.watchedResources(), "secrets")
+	assert.Equal(t, []string{"secrets"}, wh.capabilities.DisabledWatchers)
+	assert.ElementsMatch(t, []missingPermission{
+		{Resource: "secrets", Verbs: []string{"watch"}},
+		{Group: "batch", Resource: "jobs", Verbs: []string{"get"}},
+	}, wh.capabilities.MissingPermissions)
+
+	// the capabilities are sent with the cluster info of the first report
+	wh.clusterAPIServerVersion = &version.Info{}
+	wh.aggregateFirstDataFlag = true
+	wh.jsonReport.FirstReport = true
+	assert.Contains(t, string(prepareDataToSend(context.Background(), wh)), `"disabledWatchers":["secrets"]`)
+}
@@ -9,6 +9,7 @@ import (
 	"reflect"
 	"runtime/debug"
 	"strings"
+	"sync"
 	"time"
 
 	logger "github.com/kubescape/go-logger"
@@ -23,6 +24,7 @@ import (
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/watch"
 )
 
@@ -40,9 +42,18 @@ type OwnerDetNameAndKindOnly struct {
 }
 
 type MicroServiceData struct {
-	*core.Pod `json:",inline"`
-	Owner     OwnerDet `json:"uptreeOwner"`
-	PodSpecId int      `json:"podSpecId"`
+	*core.Pod        `json:",inline"`
+	Owner            OwnerDet          `json:"uptreeOwner"`
+	PodSpecId        int               `json:"podSpecId"`
+	NetworkIsolation *NetworkIsolation `json:"networkIsolation,omitempty"`
+	// ServiceAccountBindings are the role bindings and cluster role bindings granting roles to the pods' service account
+	ServiceAccountBindings []rbacBindingRef `json:"serviceAccountBindings,omitempty"`
+	ServiceAccountName     string           `json:"serviceAccountName,omitempty"`
+	// AutomountServiceAccountToken tells whether the service account token is mounted, the pod's setting overrides the service account's
+	AutomountServiceAccountToken bool     `json:"automountServiceAccountToken"`
+	ImagePullSecrets             []string `json:"imagePullSecrets,omitempty"`
+	// PersistentVolumeClaims are the claims the pods mount through their volumes
+	PersistentVolumeClaims []claimRef `json:"persistentVolumeClaims,omitempty"`
 }
 
 type PodDataForExistMicroService struct {
@@ -54,6 +65,8 @@ type PodDataForExistMicroService struct {
 	PodStatus         string                  `json:"podStatus"`
 	CreationTimestamp string                  `json:"startedAt"`
 	DeletionTimestamp string                  `json:"terminatedAt,omitempty"`
+	// resourceVersion is the version of the reported pod, it is not reported
+	resourceVersion string
 }
 
 type ScanNewImageData struct {
@@ -75,18 +88,21 @@ func (wh *WatchHandler) PodWatch(ctx context.Context) {
 			logger.L().Ctx(ctx).Error("RECOVER ListenerAndSender", helpers.Interface("error", err), helpers.String("stack", string(debug.Stack())))
 		}
 	}()
-	var lastWatchEventCreationTime time.Time
 	collectorCreationTime = time.Now()
-	newStateChan := make(chan bool)
-	wh.newStateReportChans = append(wh.newStateReportChans, newStateChan)
+	newStateChan, unregister := wh.registerNewStateChan()
+	defer unregister()
+	logger.L().Ctx(ctx).Info("Watching over pods starting")
+	pods := wh.watchInformer(ctx, "pods", wh.informerFactory.Core().V1().Pods().Informer())
+	reconcile, stopReconcile := newReconcileTicker()
+	defer stopReconcile()
 	for {
-		logger.L().Ctx(ctx).Info("Watching over pods starting")
-		podsWatcher, err := wh.RestAPIClient.CoreV1().Pods("").Watch(globalHTTPContext, metav1.ListOptions{Watch: true})
-		if err != nil {
-			time.Sleep(1 * time.Second)
-			continue
+		wh.handlePodWatch(ctx, pods, newStateChan, reconcile)
+		if ctx.Err() != nil {
+			return
 		}
-		wh.handlePodWatch(ctx, podsWatcher, newStateChan, &lastWatchEventCreationTime)
+		// the new first report starts from an empty state and reports every existing object again
+		wh.pdm = make(map[int]*list.List)
+		pods.replay()
 	}
 }
 func isPodAlreadyExistInScanCandidateList(ctx context.Context, od *OwnerDet, pod *core.Pod) (bool, int) {
@@ -158,27 +174,24 @@ func checkNotificationCandidateList(pod *core.Pod, od *OwnerDet, podStatus strin
 	return false
 }
 
-func (wh *WatchHandler) handlePodWatch(ctx context.Context, podsWatcher watch.Interface, newStateChan <-chan bool, lastWatchEventCreationTime *time.Time) {
+func (wh *WatchHandler) handlePodWatch(ctx context.Context, events *informerEvents, newStateChan <-chan bool, reconcile <-chan time.Time) {
 	for {
 		var event watch.Event
-		var chanActive bool
 		select {
-		case event, chanActive = <-podsWatcher.ResultChan():
-			if !chanActive {
-				podsWatcher.Stop()
-				*lastWatchEventCreationTime = time.Now()
-				return
-			}
+		case event = <-events.next():
 		case <-newStateChan:
-			podsWatcher.Stop()
-			*lastWatchEventCreationTime = time.Now()
 			return
-		}
-		if event.Type == watch.Error {
-			logger.L().Ctx(ctx).Error("Pod watch chan loop", helpers.Interface("error", event.Object))
-			podsWatcher.Stop()
-			*lastWatchEventCreationTime = time.Now()
+		case <-events.done(ctx):
+			if events.stop() {
+				continue
+			}
 			return
+		case <-reconcile:
+			wh.reconcilePods(ctx, events)
+			continue
+		case <-wh.workloadChanges.changes():
+			wh.refreshWorkloads(wh.pdm, wh.workloadChanges.take())
+			continue
 		}
 		pod, ok := event.Object.(*core.Pod)
 		if !ok {
@@ -197,14 +210,11 @@ func (wh *WatchHandler) handlePodWatch(ctx context.Context, podsWatcher watch.In
 		logger.L().Ctx(ctx).Debug("pod", helpers.String("name", podName), helpers.String("status", podStatus), helpers.String("namespace", pod.Namespace), helpers.String("node", pod.Spec.NodeName))
 		od, err := GetAncestorOfPod(ctx, pod, wh)
 		if err != nil {
-			*lastWatchEventCreationTime = time.Now()
-			break
+			logger.L().Ctx(ctx).Error("failed to get the owner of the pod", helpers.String("name", podName), helpers.String("namespace", pod.Namespace), helpers.Error(err))
+			continue
 		}
 		switch event.Type {
 		case watch.Added:
-			if pod.CreationTimestamp.Time.Before(*lastWatchEventCreationTime) {
-				continue
-			}
 			first := true
 			id, runningPodNum := isPodSpecAlreadyExist(&od, pod.Namespace, wh.pdm)
 			if runningPodNum <= 1 {
@@ -212,9 +222,10 @@ func (wh *WatchHandler) handlePodWatch(ctx context.Context, podsWatcher watch.In
 				// we want to scan its vulnerabilities so we will use the trigger mechanism to do it
 				wh.pdm[id] = list.New()
 				nms := MicroServiceData{Pod: pod, Owner: od, PodSpecId: id}
+				wh.enrichMicroService(&nms)
 				wh.pdm[id].PushBack(nms)
 				if wh.isNamespaceWatched(pod.Namespace) {
-					wh.jsonReport.AddToJsonFormat(nms, MICROSERVICES, CREATED)
+					wh.addMicroService(nms, CREATED)
 				}
 
 			} else { // Check if pod is already reported
@@ -230,7 +241,6 @@ func (wh *WatchHandler) handlePodWatch(ctx context.Context, podsWatcher watch.In
 				}
 			}
 			if !first {
-				*lastWatchEventCreationTime = time.Now()
 				break
 			}
 
@@ -245,6 +255,7 @@ func (wh *WatchHandler) handlePodWatch(ctx context.Context, podsWatcher watch.In
 				},
 				PodStatus:         podStatus,
 				CreationTimestamp: pod.CreationTimestamp.Time.UTC().Format(time.RFC3339),
+				resourceVersion:   pod.ResourceVersion,
 			}
 			wh.pdm[id].PushBack(newPod)
 			if wh.isNamespaceWatched(pod.Namespace) {
@@ -264,7 +275,6 @@ func (wh *WatchHandler) handlePodWatch(ctx context.Context, podsWatcher watch.In
 				continue
 			}
 			if pod.DeletionTimestamp != nil { // the pod is terminating
-				*lastWatchEventCreationTime = time.Now()
 				break
 			}
 			podSpecID, newPodData := wh.updatePod(pod, wh.pdm, podStatus)
@@ -276,7 +286,7 @@ func (wh *WatchHandler) handlePodWatch(ctx context.Context, podsWatcher watch.In
 				wh.jsonReport.AddToJsonFormat(newPodData, PODS, UPDATED)
 			}
 			if podSpecID > -1 {
-				wh.jsonReport.AddToJsonFormat(wh.pdm[podSpecID].Front().Value.(MicroServiceData), MICROSERVICES, UPDATED)
+				wh.addMicroService(wh.pdm[podSpecID].Front().Value.(MicroServiceData), UPDATED)
 			}
 			if podSpecID > -2 {
 				informNewDataArrive(wh)
@@ -287,17 +297,30 @@ func (wh *WatchHandler) handlePodWatch(ctx context.Context, podsWatcher watch.In
 				continue
 			}
 			wh.DeletePod(ctx, pod, podName)
-		case watch.Bookmark:
-			logger.L().Ctx(ctx).Debug("Pod Bookmark", helpers.String("name", podName), helpers.String("status", podStatus), helpers.String("namespace", pod.Namespace), helpers.String("node", pod.Spec.NodeName))
-		case watch.Error:
-			removePodScanNotificationCandidateList(&od, pod)
-			logger.L().Ctx(ctx).Debug("Pod Error", helpers.String("name", podName), helpers.String("status", podStatus), helpers.String("namespace", pod.Namespace), helpers.String("node", pod.Spec.NodeName))
-			*lastWatchEventCreationTime = time.Now()
-			return
 		}
 	}
 }
 
+// reconcilePods corrects the pods the watch stream missed
+func (wh *WatchHandler) reconcilePods(ctx context.Context, events *informerEvents) {
+	reported := reportedVersions(wh.pdm, func(value interface{}) metav1.Object {
+		if pod, ok := value.(PodDataForExistMicroService); ok {
+			return &metav1.ObjectMeta{Namespace: pod.Namespace, Name: pod.PodName, ResourceVersion: pod.resourceVersion}
+		}
+		return nil
+	})
+	pods, err := wh.RestAPIClient.CoreV1().Pods("").List(ctx, listOptions("pods"))
+	if err != nil {
+		logger.L().Ctx(ctx).Error("failed to list pods for reconcile", helpers.Error(err))
+		return
+	}
+	listed := make([]runtime.Object, 0, len(pods.Items))
+	for i := range pods.Items {
+		listed = append(listed, &pods.Items[i])
+	}
+	wh.reconcile(ctx, events, reported, listed, wh.isObjectNamespaceWatched)
+}
+
 // logs all container logs of a pod in crash loop. In case the RestartCount of one of the containers is greater than 2, skipping it.
 func (wh *WatchHandler) logPodInCrashLoop(ctx context.Context, pod *core.Pod) {
 	ctx, span := otel.Tracer("").Start(ctx, "logPodInCrashLoop", trace.WithAttributes(attribute.String("pod", pod.Name)))
@@ -369,7 +392,7 @@ func (wh *WatchHandler) logPodInCrashLoop(ctx context.Context, pod *core.Pod) {
 // DeletePod delete a pod
 func (wh *WatchHandler) DeletePod(ctx context.Context, pod *core.Pod, podName string) {
 	podStatus := "Terminating"
-	podSpecID, removeMicroServiceAsWell, owner := wh.RemovePod(pod, wh.pdm)
+	podSpecID, removeMicroServiceAsWell, owner := wh.RemovePod(ctx, pod, wh.pdm)
 	if podSpecID == -1 {
 		return
 	}
@@ -381,7 +404,7 @@ func (wh *WatchHandler) DeletePod(ctx context.Context, pod *core.Pod, podName st
 	wh.jsonReport.AddToJsonFormat(np, PODS, DELETED)
 	if removeMicroServiceAsWell {
 		nms := MicroServiceData{Pod: pod, Owner: owner, PodSpecId: podSpecID}
-		wh.jsonReport.AddToJsonFormat(nms, MICROSERVICES, DELETED)
+		wh.addMicroService(nms, DELETED)
 	}
 	informNewDataArrive(wh)
 }
@@ -447,7 +470,7 @@ func GetOwnerData(ctx context.Context, name string, kind string, apiVersion stri
 	switch kind {
 	case "Deployment":
 		options := metav1.GetOptions{}
-		depDet, err := wh.RestAPIClient.AppsV1().Deployments(namespace).Get(globalHTTPContext, name, options)
+		depDet, err := wh.RestAPIClient.AppsV1().Deployments(namespace).Get(ctx, name, options)
 		if err != nil {
 			logger.L().Ctx(ctx).Error("GetOwnerData Deployments", helpers.Error(err))
 			return nil
@@ -458,7 +481,7 @@ func GetOwnerData(ctx context.Context, name string, kind string, apiVersion stri
 		return depDet
 	case "DaemonSet":
 		options := metav1.GetOptions{}
-		daemSetDet, err := wh.RestAPIClient.AppsV1().DaemonSets(namespace).Get(globalHTTPContext, name, options)
+		daemSetDet, err := wh.RestAPIClient.AppsV1().DaemonSets(namespace).Get(ctx, name, options)
 		if err != nil {
 			logger.L().Ctx(ctx).Error("GetOwnerData DaemonSet", helpers.Error(err))
 			return nil
@@ -469,7 +492,7 @@ func GetOwnerData(ctx context.Context, name string, kind string, apiVersion stri
 		return daemSetDet
 	case "StatefulSet":
 		options := metav1.GetOptions{}
-		statSetDet, err := wh.RestAPIClient.AppsV1().StatefulSets(namespace).Get(globalHTTPContext, name, options)
+		statSetDet, err := wh.RestAPIClient.AppsV1().StatefulSets(namespace).Get(ctx, name, options)
 		if err != nil {
 			logger.L().Ctx(ctx).Error("GetOwnerData StatefulSet", helpers.Error(err))
 			return nil
@@ -480,7 +503,7 @@ func GetOwnerData(ctx context.Context, name string, kind string, apiVersion stri
 		return statSetDet
 	case "Job":
 		options := metav1.GetOptions{}
-		jobDet, err := wh.RestAPIClient.BatchV1().Jobs(namespace).Get(globalHTTPContext, name, options)
+		jobDet, err := wh.RestAPIClient.BatchV1().Jobs(namespace).Get(ctx, name, options)
 		if err != nil {
 			logger.L().Ctx(ctx).Error("GetOwnerData Job", helpers.Error(err))
 			return nil
@@ -491,7 +514,7 @@ func GetOwnerData(ctx context.Context, name string, kind string, apiVersion stri
 		return jobDet
 	case "CronJob":
 		options := metav1.GetOptions{}
-		cronJobDet, err := wh.RestAPIClient.BatchV1().CronJobs(namespace).Get(globalHTTPContext, name, options)
+		cronJobDet, err := wh.RestAPIClient.BatchV1().CronJobs(namespace).Get(ctx, name, options)
 		if err != nil {
 			logger.L().Ctx(ctx).Error("GetOwnerData CronJob", helpers.Error(err))
 			return nil
@@ -502,7 +525,7 @@ func GetOwnerData(ctx context.Context, name string, kind string, apiVersion stri
 		return cronJobDet
 	case "Pod":
 		options := metav1.GetOptions{}
-		podDet, err := wh.RestAPIClient.CoreV1().Pods(namespace).Get(globalHTTPContext, name, options)
+		podDet, err := wh.RestAPIClient.CoreV1().Pods(namespace).Get(ctx, name, options)
 		if err != nil {
 			logger.L().Ctx(ctx).Error("GetOwnerData Pod", helpers.Error(err))
 			return nil
@@ -565,7 +588,7 @@ func GetAncestorOfPod(ctx context.Context, pod *core.Pod, wh *WatchHandler) (Own
 				od.Kind = crd.Kind
 			}
 		case "ReplicaSet":
-			repItem, err := wh.RestAPIClient.AppsV1().ReplicaSets(pod.ObjectMeta.Namespace).Get(globalHTTPContext, pod.OwnerReferences[0].Name, metav1.GetOptions{})
+			repItem, err := wh.RestAPIClient.AppsV1().ReplicaSets(pod.ObjectMeta.Namespace).Get(ctx, pod.OwnerReferences[0].Name, metav1.GetOptions{})
 			if err != nil {
 				if localOD, inner_err := GetAncestorFromLocalPodsList(pod, wh); inner_err == nil {
 					return *localOD, nil
@@ -585,7 +608,7 @@ func GetAncestorOfPod(ctx context.Context, pod *core.Pod, wh *WatchHandler) (Own
 				}
 
 				options := metav1.ListOptions{}
-				depList, _ := depInt.List(globalHTTPContext, options)
+				depList, _ := depInt.List(ctx, options)
 				for _, item := range depList.Items {
 					if selector.Empty() || !selector.Matches(labels.Set(pod.Labels)) {
 						continue
@@ -602,7 +625,7 @@ func GetAncestorOfPod(ctx context.Context, pod *core.Pod, wh *WatchHandler) (Own
 			od.Kind = pod.OwnerReferences[0].Kind
 			//meanwhile owner reference must be in the same namespace, so owner reference doesn't have the namespace field(may be changed in the future)
 			od.OwnerData = GetOwnerData(ctx, pod.OwnerReferences[0].Name, pod.OwnerReferences[0].Kind, pod.OwnerReferences[0].APIVersion, pod.ObjectMeta.Namespace, wh)
-			jobItem, err := wh.RestAPIClient.BatchV1().Jobs(pod.ObjectMeta.Namespace).Get(globalHTTPContext, pod.OwnerReferences[0].Name, metav1.GetOptions{})
+			jobItem, err := wh.RestAPIClient.BatchV1().Jobs(pod.ObjectMeta.Namespace).Get(ctx, pod.OwnerReferences[0].Name, metav1.GetOptions{})
 			if err != nil {
 				if localOD, inner_err := GetAncestorFromLocalPodsList(pod, wh); inner_err == nil {
 					return *localOD, nil
@@ -618,7 +641,7 @@ func GetAncestorOfPod(ctx context.Context, pod *core.Pod, wh *WatchHandler) (Own
 				break
 			}
 
-			depList, _ := wh.RestAPIClient.BatchV1().CronJobs(pod.ObjectMeta.Namespace).List(globalHTTPContext, metav1.ListOptions{})
+			depList, _ := wh.RestAPIClient.BatchV1().CronJobs(pod.ObjectMeta.Namespace).List(ctx, metav1.ListOptions{})
 			selector, err := metav1.LabelSelectorAsSelector(jobItem.Spec.Selector)
 			if err != nil {
 				return od, fmt.Errorf("error getting owner reference")
@@ -676,6 +699,10 @@ func (wh *WatchHandler) updatePod(pod *core.Pod, pdm map[int]*list.List, podStat
 
 				DeepCopy(element.Value.(PodDataForExistMicroService).Owner, &podDataForExistMicroService.Owner)
 				DeepCopyObj(podDataForExistMicroService, element.Value.(PodDataForExistMicroService))
+				// the reconcile compares the pods with the version the pods watcher handled last
+				reported := element.Value.(PodDataForExistMicroService)
+				reported.resourceVersion = pod.ResourceVersion
+				element.Value = reported
 				break
 			}
 			element = element.Next()
@@ -684,12 +711,12 @@ func (wh *WatchHandler) updatePod(pod *core.Pod, pdm map[int]*list.List, podStat
 	return id, podDataForExistMicroService
 }
 
-func (wh *WatchHandler) isMicroServiceNeedToBeRemoved(ownerData interface{}, kind, namespace string) bool {
+func (wh *WatchHandler) isMicroServiceNeedToBeRemoved(ctx context.Context, ownerData interface{}, kind, namespace string) bool {
 	switch kind {
 	case "Deployment":
 		options := metav1.GetOptions{}
 		name := ownerData.(*appsv1.Deployment).ObjectMeta.Name
-		_, err := wh.RestAPIClient.AppsV1().Deployments(namespace).Get(globalHTTPContext, name, options)
+		_, err := wh.RestAPIClient.AppsV1().Deployments(namespace).Get(ctx, name, options)
 		if errors.IsNotFound(err) {
 			return true
 		}
@@ -697,7 +724,7 @@ func (wh *WatchHandler) isMicroServiceNeedToBeRemoved(ownerData interface{}, kin
 	case "DeamonSet", "DaemonSet":
 		options := metav1.GetOptions{}
 		name := ownerData.(*appsv1.DaemonSet).ObjectMeta.Name
-		_, err := wh.RestAPIClient.AppsV1().DaemonSets(namespace).Get(globalHTTPContext, name, options)
+		_, err := wh.RestAPIClient.AppsV1().DaemonSets(namespace).Get(ctx, name, options)
 		if errors.IsNotFound(err) {
 			return true
 		}
@@ -705,14 +732,14 @@ func (wh *WatchHandler) isMicroServiceNeedToBeRemoved(ownerData interface{}, kin
 	case "StatefulSets":
 		options := metav1.GetOptions{}
 		name := ownerData.(*appsv1.StatefulSet).ObjectMeta.Name
-		_, err := wh.RestAPIClient.AppsV1().StatefulSets(namespace).Get(globalHTTPContext, name, options)
+		_, err := wh.RestAPIClient.AppsV1().StatefulSets(namespace).Get(ctx, name, options)
 		if errors.IsNotFound(err) {
 			return true
 		}
 	case "Job":
 		options := metav1.GetOptions{}
 		name := ownerData.(*batchv1.Job).ObjectMeta.Name
-		_, err := wh.RestAPIClient.BatchV1().Jobs(namespace).Get(globalHTTPContext, name, options)
+		_, err := wh.RestAPIClient.BatchV1().Jobs(namespace).Get(ctx, name, options)
 		if errors.IsNotFound(err) {
 			return true
 		}
@@ -722,14 +749,14 @@ func (wh *WatchHandler) isMicroServiceNeedToBeRemoved(ownerData interface{}, kin
 		if !ok {
 			return true
 		}
-		_, err := wh.RestAPIClient.BatchV1().CronJobs(namespace).Get(globalHTTPContext, cronJob.ObjectMeta.Name, options)
+		_, err := wh.RestAPIClient.BatchV1().CronJobs(namespace).Get(ctx, cronJob.ObjectMeta.Name, options)
 		if errors.IsNotFound(err) {
 			return true
 		}
 	case "Pod":
 		options := metav1.GetOptions{}
 		name := ownerData.(*core.Pod).ObjectMeta.Name
-		_, err := wh.RestAPIClient.CoreV1().Pods(namespace).Get(globalHTTPContext, name, options)
+		_, err := wh.RestAPIClient.CoreV1().Pods(namespace).Get(ctx, name, options)
 		if errors.IsNotFound(err) {
 			return true
 		}
@@ -739,7 +766,7 @@ func (wh *WatchHandler) isMicroServiceNeedToBeRemoved(ownerData interface{}, kin
 }
 
 // RemovePod remove pod and check if has parents. Returns 3 elements: 1. pod spec ID, 2. is owner removed, 3. owner
-func (wh *WatchHandler) RemovePod(pod *core.Pod, pdm map[int]*list.List) (int, bool, OwnerDet) {
+func (wh *WatchHandler) RemovePod(ctx context.Context, pod *core.Pod, pdm map[int]*list.List) (int, bool, OwnerDet) {
 	var owner OwnerDet
 	removed := false
 	podSpecID := -1
@@ -755,7 +782,7 @@ func (wh *WatchHandler) RemovePod(pod *core.Pod, pdm map[int]*list.List) (int, b
 				podSpecID = id
 				if v.Len() <= 1 {
 					msd := v.Front().Value.(MicroServiceData)
-					removed = wh.isMicroServiceNeedToBeRemoved(msd.Owner.OwnerData, msd.Owner.Kind, msd.ObjectMeta.Namespace)
+					removed = wh.isMicroServiceNeedToBeRemoved(ctx, msd.Owner.OwnerData, msd.Owner.Kind, msd.ObjectMeta.Namespace)
 					if removed {
 						v.Remove(v.Front())
 						delete(pdm, id)
@@ -767,7 +794,7 @@ func (wh *WatchHandler) RemovePod(pod *core.Pod, pdm map[int]*list.List) (int, b
 				v.Remove(element)
 				if v.Len() <= 1 {
 					msd := v.Front().Value.(MicroServiceData)
-					removed := wh.isMicroServiceNeedToBeRemoved(msd.Owner.OwnerData, msd.Owner.Kind, msd.ObjectMeta.Namespace)
+					removed := wh.isMicroServiceNeedToBeRemoved(ctx, msd.Owner.OwnerData, msd.Owner.Kind, msd.ObjectMeta.Namespace)
 					if removed {
 						v.Remove(v.Front())
 						delete(pdm, id)
@@ -804,3 +831,96 @@ func getPodStatus(pod *core.Pod) string {
 	}
 	return status
 }
+
+// enrichMicroService sets the fields of a microservice that are computed from the other watchers' caches
+func (wh *WatchHandler) enrichMicroService(microService *MicroServiceData) {
+	microService.NetworkIsolation = wh.networkIsolation(microService)
+	microService.ServiceAccountBindings = wh.serviceAccountBindings(microService)
+	wh.setServiceAccount(microService)
+	microService.PersistentVolumeClaims = wh.persistentVolumeClaims(microService)
+}
+
+// namespaceSet collects the namespaces whose workloads have to be enriched again, until the pods watcher updates them.
+// The empty namespace stands for every namespace
+type namespaceSet struct {
+	mutex      sync.Mutex
+	namespaces map[string]bool
+	changed    chan struct{}
+}
+
+func newNamespaceSet() *namespaceSet {
+	return &namespaceSet{namespaces: map[string]bool{}, changed: make(chan struct{}, 1)}
+}
+
+func (set *namespaceSet) add(namespace string) {
+	if set == nil {
+		return
+	}
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+	set.namespaces[namespace] = true
+	select {
+	case set.changed <- struct{}{}:
+	default:
+	}
+}
+
+// changes is signalled when namespaces were added, it is nil for a nil set
+func (set *namespaceSet) changes() <-chan struct{} {
+	if set == nil {
+		return nil
+	}
+	return set.changed
+}
+
+func (set *namespaceSet) take() []string {
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+	namespaces := make([]string, 0, len(set.namespaces))
+	for namespace := range set.namespaces {
+		namespaces = append(namespaces, namespace)
+	}
+	set.namespaces = map[string]bool{}
+	return namespaces
+}
+
+// workloadsChanged makes the pods and the cron jobs watchers compute the workloads of the namespace again
+func (wh *WatchHandler) workloadsChanged(namespace string) {
+	wh.workloadChanges.add(namespace)
+	wh.cronJobChanges.add(namespace)
+}
+
+// refreshWorkloads enriches the workloads of the namespaces again and reports the ones that changed. It must be called
+// from the goroutine of the watcher that owns the workloads
+func (wh *WatchHandler) refreshWorkloads(workloads map[int]*list.List, namespaces []string) {
+	changed := false
+	for id, v := range workloads {
+		if v == nil || v.Front() == nil {
+			continue
+		}
+		microService, ok := v.Front().Value.(MicroServiceData)
+		if !ok || microService.Pod == nil || !namespacesMatch(namespaces, microService.Namespace) {
+			continue
+		}
+		enriched := microService
+		wh.enrichMicroService(&enriched)
+		if reflect.DeepEqual(enriched, microService) {
+			continue
+		}
+		workloads[id].Front().Value = enriched
+		wh.addMicroService(enriched, UPDATED)
+		changed = true
+	}
+	if changed {
+		informNewDataArrive(wh)
+	}
+}
+
+func namespacesMatch(namespaces []string, namespace string) bool {
+	for _, pattern := range namespaces {
+		if namespaceMatches(pattern, namespace) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,562 @@
+package watch
+
+import (
+	"fmt"
+	"reflect"
+	"runtime/debug"
+	"sort"
+	"strings"
+
+	logger "github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+	"golang.org/x/net/context"
+	core "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	serviceAccountUserPrefix  = "system:serviceaccount:"
+	serviceAccountsGroup      = "system:serviceaccounts"
+	authenticatedGroup        = "system:authenticated"
+	defaultServiceAccountName = "default"
+	// bindingSubjectIndex indexes the role bindings and the cluster role bindings by the namespace/name of the service
+	// accounts they name and by the groups they name
+	bindingSubjectIndex = "bindingSubject"
+	groupIndexPrefix    = "group:"
+)
+
+// bindingSubject is a subject of a binding. Service accounts named as users are resolved to service accounts, and
+// carry the namespace they default to
+type bindingSubject struct {
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// roleBindingData is a role binding of the report, with its resolved subjects
+type roleBindingData struct {
+	*rbacv1.RoleBinding `json:",inline"`
+	Subjects            []bindingSubject `json:"resolvedSubjects"`
+}
+
+// clusterRoleBindingData is a cluster role binding of the report, with its resolved subjects
+type clusterRoleBindingData struct {
+	*rbacv1.ClusterRoleBinding `json:",inline"`
+	Subjects                   []bindingSubject `json:"resolvedSubjects"`
+}
+
+// clusterRoleData is a cluster role of the report. An aggregated cluster role carries the rules of the cluster roles
+// its aggregation rule selects
+type clusterRoleData struct {
+	*rbacv1.ClusterRole `json:",inline"`
+	AggregatedFrom      []string            `json:"aggregatedFrom,omitempty"`
+	EffectiveRules      []rbacv1.PolicyRule `json:"effectiveRules,omitempty"`
+}
+
+// rbacBindingRef is a binding that grants a role to a workload's service account
+type rbacBindingRef struct {
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+	RoleKind  string `json:"roleKind"`
+	RoleName  string `json:"roleName"`
+}
+
+// resolveSubjects defaults the namespace of the service accounts to the namespace of the binding, and resolves the
+// service account users, e.g. system:serviceaccount:default:builder
+func resolveSubjects(subjects []rbacv1.Subject, bindingNamespace string) []bindingSubject {
+	resolved := make([]bindingSubject, 0, len(subjects))
+	for _, subject := range subjects {
+		s := bindingSubject{Kind: subject.Kind, Name: subject.Name, Namespace: subject.Namespace}
+		switch subject.Kind {
+		case rbacv1.ServiceAccountKind:
+			if s.Namespace == "" {
+				s.Namespace = bindingNamespace
+			}
+		case rbacv1.UserKind:
+			if parts := strings.Split(strings.TrimPrefix(subject.Name, serviceAccountUserPrefix), ":"); strings.HasPrefix(subject.Name, serviceAccountUserPrefix) && len(parts) == 2 {
+				s = bindingSubject{Kind: rbacv1.ServiceAccountKind, Name: parts[1], Namespace: parts[0]}
+			}
+		}
+		resolved = append(resolved, s)
+	}
+	return resolved
+}
+
+// subjectsMatchServiceAccount reports whether the subjects name the service account, directly or by one of its groups
+func subjectsMatchServiceAccount(subjects []bindingSubject, namespace, name string) bool {
+	for _, subject := range subjects {
+		switch subject.Kind {
+		case rbacv1.ServiceAccountKind:
+			if subject.Name == name && subject.Namespace == namespace {
+				return true
+			}
+		case rbacv1.GroupKind:
+			if subject.Name == serviceAccountsGroup || subject.Name == serviceAccountsGroup+":"+namespace || subject.Name == authenticatedGroup {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// subjectIndexKeys returns the keys the bindingSubjectIndex indexes a binding's subjects by
+func subjectIndexKeys(subjects []bindingSubject) []string {
+	keys := []string{}
+	for _, subject := range subjects {
+		switch subject.Kind {
+		case rbacv1.ServiceAccountKind:
+			keys = append(keys, subject.Namespace+"/"+subject.Name)
+		case rbacv1.GroupKind:
+			keys = append(keys, groupIndexPrefix+subject.Name)
+		}
+	}
+	return keys
+}
+
+// indexBindingSubjects is the index function of the bindingSubjectIndex
+func indexBindingSubjects(obj interface{}) ([]string, error) {
+	switch binding := obj.(type) {
+	case *rbacv1.RoleBinding:
+		return subjectIndexKeys(resolveSubjects(binding.Subjects, binding.Namespace)), nil
+	case *rbacv1.ClusterRoleBinding:
+		return subjectIndexKeys(resolveSubjects(binding.Subjects, "")), nil
+	}
+	return nil, nil
+}
+
+// serviceAccountIndexKeys returns the keys of the bindingSubjectIndex that name the service account, directly or by
+// one of its groups
+func serviceAccountIndexKeys(namespace, name string) []string {
+	return []string{
+		namespace + "/" + name,
+		groupIndexPrefix + serviceAccountsGroup,
+		groupIndexPrefix + serviceAccountsGroup + ":" + namespace,
+		groupIndexPrefix + authenticatedGroup,
+	}
+}
+
+// subjectNamespaces returns the namespaces of the service accounts the subjects name, the empty namespace when they
+// name the service accounts of every namespace
+func subjectNamespaces(subjects []bindingSubject) []string {
+	namespaces := []string{}
+	for _, subject := range subjects {
+		switch subject.Kind {
+		case rbacv1.ServiceAccountKind:
+			namespaces = append(namespaces, subject.Namespace)
+		case rbacv1.GroupKind:
+			if subject.Name == serviceAccountsGroup || subject.Name == authenticatedGroup {
+				return []string{""}
+			}
+			if strings.HasPrefix(subject.Name, serviceAccountsGroup+":") {
+				namespaces = append(namespaces, strings.TrimPrefix(subject.Name, serviceAccountsGroup+":"))
+			}
+		}
+	}
+	return namespaces
+}
+
+// boundNamespaces keeps the namespaces of the subjects of every binding as it was last handled, so the workloads of
+// the service accounts a binding no longer names are computed again too
+type boundNamespaces map[string][]string
+
+// changed records the subjects of the binding and returns the namespaces of its former and its current subjects
+func (bound boundNamespaces) changed(key string, eventType watch.EventType, subjects []bindingSubject) []string {
+	current := subjectNamespaces(subjects)
+	namespaces := append(append([]string{}, bound[key]...), current...)
+	if eventType == watch.Deleted {
+		delete(bound, key)
+	} else {
+		bound[key] = current
+	}
+	return namespaces
+}
+
+// podServiceAccount returns the name of the service account the pod runs as
+func podServiceAccount(pod *core.Pod) string {
+	if pod.Spec.ServiceAccountName != "" {
+		return pod.Spec.ServiceAccountName
+	}
+	if pod.Spec.DeprecatedServiceAccount != "" {
+		return pod.Spec.DeprecatedServiceAccount
+	}
+	return defaultServiceAccountName
+}
+
+// serviceAccountBindings lists the bindings of the workload's service account from the bindings watchers' caches
+func (wh *WatchHandler) serviceAccountBindings(microService *MicroServiceData) []rbacBindingRef {
+	if wh.informerFactory == nil || microService.Pod == nil {
+		return nil
+	}
+	namespace, name := microService.Namespace, podServiceAccount(microService.Pod)
+	refs := []rbacBindingRef{}
+	if wh.IsWatcherEnabled("rolebindings") {
+		// a role binding of any namespace may grant its role to the service account
+		for _, obj := range bindingsOfServiceAccount(wh.informerFactory.Rbac().V1().RoleBindings().Informer().GetIndexer(), namespace, name) {
+			binding, ok := obj.(*rbacv1.RoleBinding)
+			if ok && subjectsMatchServiceAccount(resolveSubjects(binding.Subjects, binding.Namespace), namespace, name) {
+				refs = append(refs, rbacBindingRef{Kind: "RoleBinding", Name: binding.Name, Namespace: binding.Namespace, RoleKind: binding.RoleRef.Kind, RoleName: binding.RoleRef.Name})
+			}
+		}
+	}
+	if wh.IsWatcherEnabled("clusterrolebindings") {
+		for _, obj := range bindingsOfServiceAccount(wh.informerFactory.Rbac().V1().ClusterRoleBindings().Informer().GetIndexer(), namespace, name) {
+			binding, ok := obj.(*rbacv1.ClusterRoleBinding)
+			if ok && subjectsMatchServiceAccount(resolveSubjects(binding.Subjects, ""), namespace, name) {
+				refs = append(refs, rbacBindingRef{Kind: "ClusterRoleBinding", Name: binding.Name, RoleKind: binding.RoleRef.Kind, RoleName: binding.RoleRef.Name})
+			}
+		}
+	}
+	if len(refs) == 0 {
+		return nil
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].Kind != refs[j].Kind {
+			return refs[i].Kind > refs[j].Kind
+		}
+		if refs[i].Namespace != refs[j].Namespace {
+			return refs[i].Namespace < refs[j].Namespace
+		}
+		return refs[i].Name < refs[j].Name
+	})
+	return refs
+}
+
+// bindingsOfServiceAccount looks the bindings that name the service account up in the bindingSubjectIndex, every
+// binding once
+func bindingsOfServiceAccount(indexer cache.Indexer, namespace, name string) []interface{} {
+	found := map[interface{}]bool{}
+	bindings := []interface{}{}
+	for _, key := range serviceAccountIndexKeys(namespace, name) {
+		objs, err := indexer.ByIndex(bindingSubjectIndex, key)
+		if err != nil {
+			return nil
+		}
+		for _, obj := range objs {
+			if !found[obj] {
+				found[obj] = true
+				bindings = append(bindings, obj)
+			}
+		}
+	}
+	return bindings
+}
+
+// aggregateClusterRole computes the effective rules of an aggregated cluster role from the cluster roles it selects
+func aggregateClusterRole(clusterRole *rbacv1.ClusterRole, clusterRoles []*rbacv1.ClusterRole) clusterRoleData {
+	data := clusterRoleData{ClusterRole: clusterRole}
+	if clusterRole.AggregationRule == nil {
+		return data
+	}
+	sorted := append([]*rbacv1.ClusterRole{}, clusterRoles...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	for _, role := range sorted {
+		if role.Name == clusterRole.Name || !aggregationSelects(clusterRole.AggregationRule, role.Labels) {
+			continue
+		}
+		data.AggregatedFrom = append(data.AggregatedFrom, role.Name)
+		for _, rule := range role.Rules {
+			if !containsRule(data.EffectiveRules, rule) {
+				data.EffectiveRules = append(data.EffectiveRules, rule)
+			}
+		}
+	}
+	return data
+}
+
+func aggregationSelects(aggregationRule *rbacv1.AggregationRule, roleLabels map[string]string) bool {
+	for i := range aggregationRule.ClusterRoleSelectors {
+		selector, err := metav1.LabelSelectorAsSelector(&aggregationRule.ClusterRoleSelectors[i])
+		if err == nil && !selector.Empty() && selector.Matches(labels.Set(roleLabels)) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsRule(rules []rbacv1.PolicyRule, rule rbacv1.PolicyRule) bool {
+	for i := range rules {
+		if reflect.DeepEqual(rules[i], rule) {
+			return true
+		}
+	}
+	return false
+}
+
+// listClusterRoles returns the cluster roles of the cluster roles watcher's cache
+func (wh *WatchHandler) listClusterRoles() []*rbacv1.ClusterRole {
+	if wh.informerFactory == nil {
+		return nil
+	}
+	clusterRoles, _ := wh.informerFactory.Rbac().V1().ClusterRoles().Lister().List(labels.Everything())
+	return clusterRoles
+}
+
+// RoleWatch watch over roles
+func (wh *WatchHandler) RoleWatch(ctx context.Context) {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.L().Ctx(ctx).Error("RECOVER RoleWatch", helpers.Interface("error", err), helpers.String("stack", string(debug.Stack())))
+		}
+	}()
+	newStateChan, unregister := wh.registerNewStateChan()
+	defer unregister()
+	logger.L().Info("Watching over roles starting")
+	roles := wh.watchInformer(ctx, "roles", wh.informerFactory.Rbac().V1().Roles().Informer())
+	for {
+		wh.handleRoleWatch(ctx, roles, newStateChan)
+		if ctx.Err() != nil {
+			return
+		}
+		// report every existing object again in the new first report
+		roles.replay()
+	}
+}
+
+func (wh *WatchHandler) handleRoleWatch(ctx context.Context, events *informerEvents, newStateChan <-chan bool) {
+	logger.L().Info("Watching over roles started")
+	for {
+		var event watch.Event
+		select {
+		case event = <-events.next():
+		case <-newStateChan:
+			return
+		case <-events.done(ctx):
+			if events.stop() {
+				continue
+			}
+			return
+		}
+		role, ok := event.Object.(*rbacv1.Role)
+		if !ok {
+			logger.L().Ctx(ctx).Error("failed to handle role event", helpers.Error(fmt.Errorf("got unexpected role from chan")))
+			continue
+		}
+		if !wh.isNamespaceWatched(role.Namespace) {
+			continue
+		}
+		role.ManagedFields = []metav1.ManagedFieldsEntry{}
+		switch event.Type {
+		case watch.Added:
+			informNewDataArrive(wh)
+			wh.jsonReport.AddToJsonFormat(role, ROLES, CREATED)
+		case watch.Modified:
+			informNewDataArrive(wh)
+			wh.jsonReport.AddToJsonFormat(role, ROLES, UPDATED)
+		case watch.Deleted:
+			informNewDataArrive(wh)
+			wh.jsonReport.AddToJsonFormat(role, ROLES, DELETED)
+		}
+	}
+}
+
+// ClusterRoleWatch watch over cluster roles
+func (wh *WatchHandler) ClusterRoleWatch(ctx context.Context) {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.L().Ctx(ctx).Error("RECOVER ClusterRoleWatch", helpers.Interface("error", err), helpers.String("stack", string(debug.Stack())))
+		}
+	}()
+	newStateChan, unregister := wh.registerNewStateChan()
+	defer unregister()
+	logger.L().Info("Watching over cluster roles starting")
+	clusterRoles := wh.watchInformer(ctx, "clusterroles", wh.informerFactory.Rbac().V1().ClusterRoles().Informer())
+	for {
+		wh.handleClusterRoleWatch(ctx, clusterRoles, newStateChan)
+		if ctx.Err() != nil {
+			return
+		}
+		// report every existing object again in the new first report
+		clusterRoles.replay()
+	}
+}
+
+func (wh *WatchHandler) handleClusterRoleWatch(ctx context.Context, events *informerEvents, newStateChan <-chan bool) {
+	logger.L().Info("Watching over cluster roles started")
+	// reported is the aggregation of every aggregated cluster role as it was last reported
+	reported := map[string]clusterRoleData{}
+	for {
+		var event watch.Event
+		select {
+		case event = <-events.next():
+		case <-newStateChan:
+			return
+		case <-events.done(ctx):
+			if events.stop() {
+				continue
+			}
+			return
+		}
+		clusterRole, ok := event.Object.(*rbacv1.ClusterRole)
+		if !ok {
+			logger.L().Ctx(ctx).Error("failed to handle cluster role event", helpers.Error(fmt.Errorf("got unexpected cluster role from chan")))
+			continue
+		}
+		clusterRole.ManagedFields = []metav1.ManagedFieldsEntry{}
+		clusterRoles := wh.listClusterRoles()
+		data := aggregateClusterRole(clusterRole, clusterRoles)
+		switch event.Type {
+		case watch.Added:
+			informNewDataArrive(wh)
+			wh.jsonReport.AddToJsonFormat(data, CLUSTERROLES, CREATED)
+		case watch.Modified:
+			informNewDataArrive(wh)
+			wh.jsonReport.AddToJsonFormat(data, CLUSTERROLES, UPDATED)
+		case watch.Deleted:
+			informNewDataArrive(wh)
+			wh.jsonReport.AddToJsonFormat(data, CLUSTERROLES, DELETED)
+		}
+		if clusterRole.AggregationRule != nil {
+			if event.Type == watch.Deleted {
+				delete(reported, clusterRole.Name)
+			} else {
+				reported[clusterRole.Name] = data
+			}
+		}
+		// the cluster role may have joined or left an aggregation with its new labels, so every aggregated cluster role
+		// is computed again and reported when its effective rules changed
+		for _, aggregated := range clusterRoles {
+			previous, ok := reported[aggregated.Name]
+			if !ok || aggregated.AggregationRule == nil || aggregated.Name == clusterRole.Name {
+				continue
+			}
+			aggregated = aggregated.DeepCopy()
+			aggregated.ManagedFields = []metav1.ManagedFieldsEntry{}
+			current := aggregateClusterRole(aggregated, clusterRoles)
+			if reflect.DeepEqual(previous.AggregatedFrom, current.AggregatedFrom) && reflect.DeepEqual(previous.EffectiveRules, current.EffectiveRules) {
+				continue
+			}
+			reported[aggregated.Name] = current
+			informNewDataArrive(wh)
+			wh.jsonReport.AddToJsonFormat(current, CLUSTERROLES, UPDATED)
+		}
+	}
+}
+
+// RoleBindingWatch watch over role bindings
+func (wh *WatchHandler) RoleBindingWatch(ctx context.Context) {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.L().Ctx(ctx).Error("RECOVER RoleBindingWatch", helpers.Interface("error", err), helpers.String("stack", string(debug.Stack())))
+		}
+	}()
+	newStateChan, unregister := wh.registerNewStateChan()
+	defer unregister()
+	logger.L().Info("Watching over role bindings starting")
+	roleBindings := wh.watchInformer(ctx, "rolebindings", wh.informerFactory.Rbac().V1().RoleBindings().Informer())
+	for {
+		wh.handleRoleBindingWatch(ctx, roleBindings, newStateChan)
+		if ctx.Err() != nil {
+			return
+		}
+		// report every existing object again in the new first report
+		roleBindings.replay()
+	}
+}
+
+func (wh *WatchHandler) handleRoleBindingWatch(ctx context.Context, events *informerEvents, newStateChan <-chan bool) {
+	logger.L().Info("Watching over role bindings started")
+	bound := boundNamespaces{}
+	for {
+		var event watch.Event
+		select {
+		case event = <-events.next():
+		case <-newStateChan:
+			return
+		case <-events.done(ctx):
+			if events.stop() {
+				continue
+			}
+			return
+		}
+		roleBinding, ok := event.Object.(*rbacv1.RoleBinding)
+		if !ok {
+			logger.L().Ctx(ctx).Error("failed to handle role binding event", helpers.Error(fmt.Errorf("got unexpected role binding from chan")))
+			continue
+		}
+		if !wh.isNamespaceWatched(roleBinding.Namespace) {
+			continue
+		}
+		roleBinding.ManagedFields = []metav1.ManagedFieldsEntry{}
+		data := roleBindingData{RoleBinding: roleBinding, Subjects: resolveSubjects(roleBinding.Subjects, roleBinding.Namespace)}
+		switch event.Type {
+		case watch.Added:
+			informNewDataArrive(wh)
+			wh.jsonReport.AddToJsonFormat(data, ROLEBINDINGS, CREATED)
+		case watch.Modified:
+			informNewDataArrive(wh)
+			wh.jsonReport.AddToJsonFormat(data, ROLEBINDINGS, UPDATED)
+		case watch.Deleted:
+			informNewDataArrive(wh)
+			wh.jsonReport.AddToJsonFormat(data, ROLEBINDINGS, DELETED)
+		}
+		// the role binding grants its role to the service accounts of its subjects, which may live in other namespaces
+		for _, namespace := range bound.changed(roleBinding.Namespace+"/"+roleBinding.Name, event.Type, data.Subjects) {
+			wh.workloadsChanged(namespace)
+		}
+	}
+}
+
+// ClusterRoleBindingWatch watch over cluster role bindings
+func (wh *WatchHandler) ClusterRoleBindingWatch(ctx context.Context) {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.L().Ctx(ctx).Error("RECOVER ClusterRoleBindingWatch", helpers.Interface("error", err), helpers.String("stack", string(debug.Stack())))
+		}
+	}()
+	newStateChan, unregister := wh.registerNewStateChan()
+	defer unregister()
+	logger.L().Info("Watching over cluster role bindings starting")
+	clusterRoleBindings := wh.watchInformer(ctx, "clusterrolebindings", wh.informerFactory.Rbac().V1().ClusterRoleBindings().Informer())
+	for {
+		wh.handleClusterRoleBindingWatch(ctx, clusterRoleBindings, newStateChan)
+		if ctx.Err() != nil {
+			return
+		}
+		// report every existing object again in the new first report
+		clusterRoleBindings.replay()
+	}
+}
+
+func (wh *WatchHandler) handleClusterRoleBindingWatch(ctx context.Context, events *informerEvents, newStateChan <-chan bool) {
+	logger.L().Info("Watching over cluster role bindings started")
+	bound := boundNamespaces{}
+	for {
+		var event watch.Event
+		select {
+		case event = <-events.next():
+		case <-newStateChan:
+			return
+		case <-events.done(ctx):
+			if events.stop() {
+				continue
+			}
+			return
+		}
+		clusterRoleBinding, ok := event.Object.(*rbacv1.ClusterRoleBinding)
+		if !ok {
+			logger.L().Ctx(ctx).Error("failed to handle cluster role binding event", helpers.Error(fmt.Errorf("got unexpected cluster role binding from chan")))
+			continue
+		}
+		clusterRoleBinding.ManagedFields = []metav1.ManagedFieldsEntry{}
+		data := clusterRoleBindingData{ClusterRoleBinding: clusterRoleBinding, Subjects: resolveSubjects(clusterRoleBinding.Subjects, "")}
+		switch event.Type {
+		case watch.Added:
+			informNewDataArrive(wh)
+			wh.jsonReport.AddToJsonFormat(data, CLUSTERROLEBINDINGS, CREATED)
+		case watch.Modified:
+			informNewDataArrive(wh)
+			wh.jsonReport.AddToJsonFormat(data, CLUSTERROLEBINDINGS, UPDATED)
+		case watch.Deleted:
+			informNewDataArrive(wh)
+			wh.jsonReport.AddToJsonFormat(data, CLUSTERROLEBINDINGS, DELETED)
+		}
+		for _, namespace := range bound.changed(clusterRoleBinding.Name, event.Type, data.Subjects) {
+			wh.workloadsChanged(namespace)
+		}
+	}
+}
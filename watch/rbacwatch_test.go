@@ -0,0 +1,154 @@
+package watch
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	core "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestResolveSubjects(t *testing.T) {
+	subjects := resolveSubjects([]rbacv1.Subject{
+		{Kind: rbacv1.ServiceAccountKind, Name: "builder"},
+		{Kind: rbacv1.UserKind, Name: "system:serviceaccount:ci:runner"},
+		{Kind: rbacv1.UserKind, Name: "alice"},
+	}, "shop")
+	assert.Equal(t, []bindingSubject{
+		{Kind: rbacv1.ServiceAccountKind, Name: "builder", Namespace: "shop"},
+		{Kind: rbacv1.ServiceAccountKind, Name: "runner", Namespace: "ci"},
+		{Kind: rbacv1.UserKind, Name: "alice"},
+	}, subjects)
+	assert.True(t, subjectsMatchServiceAccount(subjects, "ci", "runner"))
+	assert.False(t, subjectsMatchServiceAccount(subjects, "shop", "runner"))
+	assert.True(t, subjectsMatchServiceAccount([]bindingSubject{{Kind: rbacv1.GroupKind, Name: "system:serviceaccounts:shop"}}, "shop", "default"))
+}
+
+func TestAggregateClusterRole(t *testing.T) {
+	read := rbacv1.PolicyRule{Verbs: []string{"get"}, Resources: []string{"pods"}}
+	write := rbacv1.PolicyRule{Verbs: []string{"update"}, Resources: []string{"pods"}}
+	monitoring := &rbacv1.ClusterRole{
+		ObjectMeta:      metav1.ObjectMeta{Name: "monitoring"},
+		AggregationRule: &rbacv1.AggregationRule{ClusterRoleSelectors: []metav1.LabelSelector{{MatchLabels: map[string]string{"aggregate-to-monitoring": "true"}}}},
+	}
+	clusterRoles := []*rbacv1.ClusterRole{
+		monitoring,
+		{ObjectMeta: metav1.ObjectMeta{Name: "pod-writer", Labels: map[string]string{"aggregate-to-monitoring": "true"}}, Rules: []rbacv1.PolicyRule{read, write}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "pod-reader", Labels: map[string]string{"aggregate-to-monitoring": "true"}}, Rules: []rbacv1.PolicyRule{read}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "other"}, Rules: []rbacv1.PolicyRule{{Verbs: []string{"*"}}}},
+	}
+
+	data := aggregateClusterRole(monitoring, clusterRoles)
+	assert.Equal(t, []string{"pod-reader", "pod-writer"}, data.AggregatedFrom)
+	assert.Equal(t, []rbacv1.PolicyRule{read, write}, data.EffectiveRules)
+	assert.Empty(t, aggregateClusterRole(clusterRoles[1], clusterRoles).EffectiveRules)
+}
+
+func TestAggregatedClusterRoleFollowsLabelChanges(t *testing.T) {
+	read := rbacv1.PolicyRule{Verbs: []string{"get"}, Resources: []string{"pods"}}
+	wh := &WatchHandler{
+		informerFactory:      newInformerFactory(fake.NewSimpleClientset()),
+		informNewDataChannel: make(chan int, 1),
+	}
+	store := wh.informerFactory.Rbac().V1().ClusterRoles().Informer().GetStore()
+	monitoring := &rbacv1.ClusterRole{
+		ObjectMeta:      metav1.ObjectMeta{Name: "monitoring"},
+		AggregationRule: &rbacv1.AggregationRule{ClusterRoleSelectors: []metav1.LabelSelector{{MatchLabels: map[string]string{"aggregate-to-monitoring": "true"}}}},
+	}
+	reader := &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "pod-reader", Labels: map[string]string{"aggregate-to-monitoring": "true"}}, Rules: []rbacv1.PolicyRule{read}}
+	assert.NoError(t, store.Add(monitoring))
+	assert.NoError(t, store.Add(reader))
+
+	clusterRoles := newInformerEvents("clusterroles", nil, nil)
+	newStateChan := make(chan bool)
+	done := make(chan struct{})
+	go func() {
+		wh.handleClusterRoleWatch(context.Background(), clusterRoles, newStateChan)
+		close(done)
+	}()
+	clusterRoles.events <- watch.Event{Type: watch.Added, Object: monitoring.DeepCopy()}
+	clusterRoles.events <- watch.Event{Type: watch.Added, Object: reader.DeepCopy()}
+
+	// the pod reader no longer matches the selector of the aggregated role, the aggregated role loses its rules
+	unlabeled := reader.DeepCopy()
+	unlabeled.Labels = nil
+	assert.NoError(t, store.Update(unlabeled))
+	clusterRoles.events <- watch.Event{Type: watch.Modified, Object: unlabeled.DeepCopy()}
+	// an unrelated change does not report the aggregated role again
+	clusterRoles.events <- watch.Event{Type: watch.Modified, Object: unlabeled.DeepCopy()}
+	newStateChan <- true
+	<-done
+
+	assert.Len(t, wh.jsonReport.ClusterRoles.Created, 2)
+	var updated []clusterRoleData
+	for _, data := range wh.jsonReport.ClusterRoles.Updated {
+		if data.(clusterRoleData).Name == "monitoring" {
+			updated = append(updated, data.(clusterRoleData))
+		}
+	}
+	if assert.Len(t, updated, 1) {
+		assert.Empty(t, updated[0].AggregatedFrom)
+		assert.Empty(t, updated[0].EffectiveRules)
+	}
+}
+
+func TestServiceAccountBindings(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "builder-edit"},
+			Subjects:   []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: "builder"}},
+			RoleRef:    rbacv1.RoleRef{Kind: "ClusterRole", Name: "edit"},
+		},
+		&rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "default-view"},
+			Subjects:   []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: "default"}},
+			RoleRef:    rbacv1.RoleRef{Kind: "Role", Name: "view"},
+		},
+		&rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ci", Name: "builder-deploy"},
+			Subjects:   []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: "builder", Namespace: "shop"}},
+			RoleRef:    rbacv1.RoleRef{Kind: "Role", Name: "deploy"},
+		},
+		&rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ci", Name: "shop-view"},
+			Subjects:   []rbacv1.Subject{{Kind: rbacv1.GroupKind, Name: "system:serviceaccounts:shop"}},
+			RoleRef:    rbacv1.RoleRef{Kind: "Role", Name: "view"},
+		},
+		&rbacv1.ClusterRoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "builder-admin"},
+			Subjects:   []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: "builder", Namespace: "shop"}},
+			RoleRef:    rbacv1.RoleRef{Kind: "ClusterRole", Name: "admin"},
+		},
+	)
+	wh := &WatchHandler{informerFactory: newInformerFactory(client)}
+	startInformers(t, wh.informerFactory, wh.informerFactory.Rbac().V1().RoleBindings().Informer(), wh.informerFactory.Rbac().V1().ClusterRoleBindings().Informer())
+
+	pod := &core.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "builder-1"}, Spec: core.PodSpec{ServiceAccountName: "builder"}}
+	// the role bindings of other namespaces grant their roles to the service account too
+	assert.Equal(t, []rbacBindingRef{
+		{Kind: "RoleBinding", Name: "builder-deploy", Namespace: "ci", RoleKind: "Role", RoleName: "deploy"},
+		{Kind: "RoleBinding", Name: "shop-view", Namespace: "ci", RoleKind: "Role", RoleName: "view"},
+		{Kind: "RoleBinding", Name: "builder-edit", Namespace: "shop", RoleKind: "ClusterRole", RoleName: "edit"},
+		{Kind: "ClusterRoleBinding", Name: "builder-admin", RoleKind: "ClusterRole", RoleName: "admin"},
+	}, wh.serviceAccountBindings(&MicroServiceData{Pod: pod}))
+
+	wh.disabledWatchers = map[string]bool{"clusterrolebindings": true}
+	assert.Len(t, wh.serviceAccountBindings(&MicroServiceData{Pod: pod}), 3)
+}
+
+func TestBoundNamespaces(t *testing.T) {
+	bound := boundNamespaces{}
+	builder := []bindingSubject{{Kind: rbacv1.ServiceAccountKind, Name: "builder", Namespace: "shop"}}
+	assert.Equal(t, []string{"shop"}, bound.changed("ci/deploy", watch.Added, builder))
+
+	// the workloads of the former subjects are computed again too
+	group := []bindingSubject{{Kind: rbacv1.GroupKind, Name: "system:serviceaccounts:billing"}}
+	assert.Equal(t, []string{"shop", "billing"}, bound.changed("ci/deploy", watch.Modified, group))
+	assert.Equal(t, []string{"billing", ""}, bound.changed("ci/deploy", watch.Modified, []bindingSubject{{Kind: rbacv1.GroupKind, Name: authenticatedGroup}}))
+	assert.Equal(t, []string{""}, bound.changed("ci/deploy", watch.Deleted, nil))
+	assert.Empty(t, bound)
+}
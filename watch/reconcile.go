@@ -0,0 +1,167 @@
+package watch
+
+import (
+	"container/list"
+	"context"
+	"strconv"
+	"time"
+
+	logger "github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric/global"
+	"go.opentelemetry.io/otel/metric/instrument"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	ReconcileIntervalEnv = "RECONCILE_INTERVAL"
+)
+
+var reconcileDriftCounter, _ = global.Meter("kollector").SyncInt64().Counter("kollector.reconcile.drift",
+	instrument.WithDescription("Objects the watch stream missed and the periodic reconcile corrected"))
+
+// newReconcileTicker returns a channel that fires every RECONCILE_INTERVAL, or a nil channel when the interval is 0,
+// and the function that stops it
+func newReconcileTicker() (<-chan time.Time, func()) {
+	interval := time.Duration(getNumericValueFromEnvVar(ReconcileIntervalEnv, 0)) * time.Second
+	if interval <= 0 {
+		return nil, func() {}
+	}
+	ticker := time.NewTicker(interval)
+	return ticker.C, ticker.Stop
+}
+
+// reconcile queues the events that correct the difference between the objects the API server listed and the objects
+// the watcher reported, the watcher handles them before the informer's next event. reported maps the namespace/name of
+// the reported objects to their resourceVersion, the watcher takes it before it lists the objects. It must be called
+// from the watcher's goroutine. watched selects the objects that are compared, all of them when it is nil
+func (wh *WatchHandler) reconcile(ctx context.Context, events *informerEvents, reported map[string]string, listed []runtime.Object, watched func(metav1.Object) bool) {
+	cached := map[string]runtime.Object{}
+	for _, obj := range events.informer.GetStore().List() {
+		object, ok := obj.(runtime.Object)
+		if !ok || !isReconciled(object, watched) {
+			continue
+		}
+		if key, err := cache.MetaNamespaceKeyFunc(object); err == nil {
+			cached[key] = object.DeepCopyObject()
+		}
+	}
+	compared := make([]runtime.Object, 0, len(listed))
+	for _, obj := range listed {
+		if isReconciled(obj, watched) {
+			compared = append(compared, obj)
+		}
+	}
+	corrections := diffObjects(compared, reported, cached)
+	drift := map[watch.EventType]int64{}
+	for i := range corrections {
+		drift[corrections[i].Type]++
+	}
+	for eventType, count := range drift {
+		reconcileDriftCounter.Add(ctx, count, attribute.String("resource", events.name), attribute.String("type", string(eventType)))
+	}
+	if len(corrections) == 0 {
+		logger.L().Ctx(ctx).Debug("reconciled without drift", helpers.String("resource", events.name), helpers.Int("objects", len(compared)))
+		return
+	}
+	logger.L().Ctx(ctx).Warning("watch stream drifted from the API server, correcting", helpers.String("resource", events.name),
+		helpers.Int("missedCreates", int(drift[watch.Added])), helpers.Int("missedUpdates", int(drift[watch.Modified])), helpers.Int("missedDeletes", int(drift[watch.Deleted])))
+	events.correct(corrections...)
+}
+
+func isReconciled(obj runtime.Object, watched func(metav1.Object) bool) bool {
+	if watched == nil {
+		return true
+	}
+	accessor, err := meta.Accessor(obj)
+	return err == nil && watched(accessor)
+}
+
+// isObjectNamespaceWatched reports whether the objects of the object's namespace are collected
+func (wh *WatchHandler) isObjectNamespaceWatched(obj metav1.Object) bool {
+	return wh.isNamespaceWatched(obj.GetNamespace())
+}
+
+// diffObjects returns the events that turn the reported objects into the listed ones. The reported and the cached
+// objects are keyed by namespace/name. An object is only updated when the listed resourceVersion is newer than the
+// reported one, and the changes the informer's cache already holds are left to the informer, which delivers them
+func diffObjects(listed []runtime.Object, reported map[string]string, cached map[string]runtime.Object) []watch.Event {
+	corrections := []watch.Event{}
+	listedKeys := map[string]bool{}
+	for _, obj := range listed {
+		key, err := cache.MetaNamespaceKeyFunc(obj)
+		if err != nil {
+			continue
+		}
+		listedKeys[key] = true
+		if cachedObj, ok := cached[key]; ok && !isNewer(resourceVersion(obj), resourceVersion(cachedObj)) {
+			continue
+		}
+		reportedVersion, ok := reported[key]
+		if !ok {
+			corrections = append(corrections, watch.Event{Type: watch.Added, Object: obj})
+			continue
+		}
+		if isNewer(resourceVersion(obj), reportedVersion) {
+			corrections = append(corrections, watch.Event{Type: watch.Modified, Object: obj})
+		}
+	}
+	for key := range reported {
+		// an object the informer's cache does not hold is deleted by the informer
+		if cachedObj, ok := cached[key]; ok && !listedKeys[key] {
+			corrections = append(corrections, watch.Event{Type: watch.Deleted, Object: cachedObj})
+		}
+	}
+	return corrections
+}
+
+// isNewer reports whether the resourceVersion is newer than the other one. The API server serves them as increasing
+// numbers, an unknown resourceVersion is never newer nor older
+func isNewer(resourceVersion, other string) bool {
+	if resourceVersion == "" || other == "" {
+		return false
+	}
+	version, err := strconv.ParseUint(resourceVersion, 10, 64)
+	otherVersion, otherErr := strconv.ParseUint(other, 10, 64)
+	if err != nil || otherErr != nil {
+		return resourceVersion != other
+	}
+	return version > otherVersion
+}
+
+// reportedVersions maps the namespace/name of the objects a watcher reported to their resourceVersion. object returns
+// the object of an element of the lists, nil for the elements that do not stand for an object
+func reportedVersions(lists map[int]*list.List, object func(interface{}) metav1.Object) map[string]string {
+	reported := map[string]string{}
+	for _, l := range lists {
+		if l == nil {
+			continue
+		}
+		for element := l.Front(); element != nil; element = element.Next() {
+			if obj := object(element.Value); obj != nil {
+				reported[objectKey(obj)] = obj.GetResourceVersion()
+			}
+		}
+	}
+	return reported
+}
+
+func objectKey(obj metav1.Object) string {
+	if obj.GetNamespace() == "" {
+		return obj.GetName()
+	}
+	return obj.GetNamespace() + "/" + obj.GetName()
+}
+
+func resourceVersion(obj runtime.Object) string {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return ""
+	}
+	return accessor.GetResourceVersion()
+}
@@ -0,0 +1,83 @@
+package watch
+
+import (
+	"container/list"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestDiffObjects(t *testing.T) {
+	service := func(name, resourceVersion string) *core.Service {
+		return &core.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, ResourceVersion: resourceVersion}}
+	}
+	listed := []runtime.Object{service("same", "1"), service("changed", "3"), service("missed", "1"), service("older", "2"), service("pending", "5")}
+	reported := map[string]string{
+		"default/same":    "1",
+		"default/changed": "2",
+		"default/older":   "3",
+		"default/pending": "4",
+		"default/deleted": "1",
+		"default/gone":    "1",
+	}
+	// the informer delivers the update of pending and the deletion of gone
+	cached := map[string]runtime.Object{
+		"default/same":    service("same", "1"),
+		"default/pending": service("pending", "5"),
+		"default/deleted": service("deleted", "1"),
+	}
+	corrections := map[string]watch.EventType{}
+	for _, event := range diffObjects(listed, reported, cached) {
+		corrections[event.Object.(*core.Service).Name] = event.Type
+	}
+	assert.Equal(t, map[string]watch.EventType{"changed": watch.Modified, "missed": watch.Added, "deleted": watch.Deleted}, corrections)
+}
+
+func TestIsNewer(t *testing.T) {
+	assert.True(t, isNewer("10", "9"))
+	assert.False(t, isNewer("9", "10"))
+	assert.False(t, isNewer("9", "9"))
+	assert.False(t, isNewer("9", ""))
+	assert.True(t, isNewer("b", "a"))
+}
+
+func TestReconcileNodes(t *testing.T) {
+	missed := &core.Node{ObjectMeta: metav1.ObjectMeta{Name: "missed", ResourceVersion: "3"}}
+	client := fake.NewSimpleClientset(missed, &core.Node{ObjectMeta: metav1.ObjectMeta{Name: "known"}})
+	wh := &WatchHandler{RestAPIClient: client, ndm: map[int]*list.List{}}
+	informer := newInformerFactory(client).Core().V1().Nodes().Informer()
+	for i, name := range []string{"known", "deleted"} {
+		assert.NoError(t, informer.GetStore().Add(&core.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}))
+		wh.ndm[i] = list.New()
+		wh.ndm[i].PushBack(&NodeData{Name: name})
+	}
+	nodes := newInformerEvents("nodes", informer, nil)
+	wh.reconcileNodes(context.Background(), nodes)
+
+	// the corrections are queued before the informer's next event
+	corrections := map[string]watch.EventType{}
+	for i := 0; i < 2; i++ {
+		event := nextEvent(t, nodes.next())
+		corrections[event.Object.(*core.Node).Name] = event.Type
+	}
+	assert.Equal(t, map[string]watch.EventType{"missed": watch.Added, "deleted": watch.Deleted}, corrections)
+	assert.Equal(t, (<-chan watch.Event)(nodes.events), nodes.next())
+
+	// the informer's events that bring the corrected changes are dropped, the later ones are delivered
+	assert.True(t, nodes.wasCorrected(watch.Added, missed))
+	assert.False(t, nodes.wasCorrected(watch.Added, missed))
+	assert.False(t, nodes.wasCorrected(watch.Modified, &core.Node{ObjectMeta: metav1.ObjectMeta{Name: "deleted"}}))
+}
+
+func TestRemoveNode(t *testing.T) {
+	ndm := map[int]*list.List{1: list.New()}
+	ndm[1].PushBack(&NodeData{Name: "node-1"})
+	assert.Equal(t, "node-1", RemoveNode(&core.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}}, ndm))
+	assert.Equal(t, 0, ndm[1].Len())
+}
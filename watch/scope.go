@@ -0,0 +1,205 @@
+package watch
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	logger "github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	batchinformers "k8s.io/client-go/informers/batch/v1"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	networkinginformers "k8s.io/client-go/informers/networking/v1"
+	rbacinformers "k8s.io/client-go/informers/rbac/v1"
+	storageinformers "k8s.io/client-go/informers/storage/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	IncludeNamespacesEnv = "INCLUDE_NAMESPACES"
+	ExcludeNamespacesEnv = "EXCLUDE_NAMESPACES"
+)
+
+const (
+	labelSelectorEnvSuffix = "_LABEL_SELECTOR"
+	fieldSelectorEnvSuffix = "_FIELD_SELECTOR"
+)
+
+// scopedResources are the resources whose list and watch take the <RESOURCE>_LABEL_SELECTOR and
+// <RESOURCE>_FIELD_SELECTOR environment variables, e.g. PODS_LABEL_SELECTOR
+var scopedResources = []string{"pods", "nodes", "services", "secrets", "namespaces", "cronjobs", "ingresses", "ingressclasses", "networkpolicies",
+	"roles", "clusterroles", "rolebindings", "clusterrolebindings", "serviceaccounts",
+	"persistentvolumes", "persistentvolumeclaims", "storageclasses"}
+
+// scopedResourceGroups are the API groups of the scoped resources that are not in the core group
+var scopedResourceGroups = map[string]string{
+	"cronjobs":            "batch",
+	"ingresses":           "networking.k8s.io",
+	"ingressclasses":      "networking.k8s.io",
+	"networkpolicies":     "networking.k8s.io",
+	"roles":               "rbac.authorization.k8s.io",
+	"clusterroles":        "rbac.authorization.k8s.io",
+	"rolebindings":        "rbac.authorization.k8s.io",
+	"clusterrolebindings": "rbac.authorization.k8s.io",
+	"storageclasses":      "storage.k8s.io",
+}
+
+// parseNamespacePatterns reads the comma separated namespace globs of an environment variable, e.g. kube-*,default
+func parseNamespacePatterns(env string) ([]string, error) {
+	patterns := []string{}
+	for _, pattern := range strings.Split(os.Getenv(env), ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid namespace pattern '%s' in %s: %s", pattern, env, err.Error())
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// parseListSelectors checks the label and field selectors of every scoped resource
+func parseListSelectors() error {
+	for _, resource := range scopedResources {
+		options := listOptions(resource)
+		if _, err := labels.Parse(options.LabelSelector); err != nil {
+			return fmt.Errorf("invalid label selector in %s: %s", selectorEnv(resource, labelSelectorEnvSuffix), err.Error())
+		}
+		if _, err := fields.ParseSelector(options.FieldSelector); err != nil {
+			return fmt.Errorf("invalid field selector in %s: %s", selectorEnv(resource, fieldSelectorEnvSuffix), err.Error())
+		}
+	}
+	return nil
+}
+
+func selectorEnv(resource, suffix string) string {
+	return strings.ToUpper(resource) + suffix
+}
+
+// listOptions are the options the API server filters a resource with, both when it is watched and when it is reconciled
+func listOptions(resource string) metav1.ListOptions {
+	return metav1.ListOptions{
+		LabelSelector: os.Getenv(selectorEnv(resource, labelSelectorEnvSuffix)),
+		FieldSelector: os.Getenv(selectorEnv(resource, fieldSelectorEnvSuffix)),
+	}
+}
+
+func tweakListOptions(resource string) func(*metav1.ListOptions) {
+	options := listOptions(resource)
+	return func(o *metav1.ListOptions) {
+		o.LabelSelector = options.LabelSelector
+		o.FieldSelector = options.FieldSelector
+	}
+}
+
+// isNamespaceSelectorSet reports whether the namespaces are filtered by labels or fields, the objects of the
+// namespaces the API server filtered out are not collected
+func isNamespaceSelectorSet() bool {
+	options := listOptions("namespaces")
+	return options.LabelSelector != "" || options.FieldSelector != ""
+}
+
+// registerScopedInformers replaces the factory's informers of the scoped resources with informers that list and watch
+// with the resources' selectors. The watchers get them from the factory as usual
+func registerScopedInformers(factory informers.SharedInformerFactory) {
+	indexers := cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}
+	factory.InformerFor(&corev1.Pod{}, func(client kubernetes.Interface, resync time.Duration) cache.SharedIndexInformer {
+		return coreinformers.NewFilteredPodInformer(client, metav1.NamespaceAll, resync, indexers, tweakListOptions("pods"))
+	})
+	factory.InformerFor(&corev1.Node{}, func(client kubernetes.Interface, resync time.Duration) cache.SharedIndexInformer {
+		return coreinformers.NewFilteredNodeInformer(client, resync, cache.Indexers{}, tweakListOptions("nodes"))
+	})
+	factory.InformerFor(&corev1.Service{}, func(client kubernetes.Interface, resync time.Duration) cache.SharedIndexInformer {
+		return coreinformers.NewFilteredServiceInformer(client, metav1.NamespaceAll, resync, indexers, tweakListOptions("services"))
+	})
+	factory.InformerFor(&corev1.Secret{}, func(client kubernetes.Interface, resync time.Duration) cache.SharedIndexInformer {
+		return coreinformers.NewFilteredSecretInformer(client, metav1.NamespaceAll, resync, indexers, tweakListOptions("secrets"))
+	})
+	factory.InformerFor(&corev1.Namespace{}, func(client kubernetes.Interface, resync time.Duration) cache.SharedIndexInformer {
+		return coreinformers.NewFilteredNamespaceInformer(client, resync, cache.Indexers{}, tweakListOptions("namespaces"))
+	})
+	factory.InformerFor(&batchv1.CronJob{}, func(client kubernetes.Interface, resync time.Duration) cache.SharedIndexInformer {
+		return batchinformers.NewFilteredCronJobInformer(client, metav1.NamespaceAll, resync, indexers, tweakListOptions("cronjobs"))
+	})
+	factory.InformerFor(&networkingv1.Ingress{}, func(client kubernetes.Interface, resync time.Duration) cache.SharedIndexInformer {
+		return networkinginformers.NewFilteredIngressInformer(client, metav1.NamespaceAll, resync, indexers, tweakListOptions("ingresses"))
+	})
+	factory.InformerFor(&networkingv1.IngressClass{}, func(client kubernetes.Interface, resync time.Duration) cache.SharedIndexInformer {
+		return networkinginformers.NewFilteredIngressClassInformer(client, resync, cache.Indexers{}, tweakListOptions("ingressclasses"))
+	})
+	factory.InformerFor(&networkingv1.NetworkPolicy{}, func(client kubernetes.Interface, resync time.Duration) cache.SharedIndexInformer {
+		return networkinginformers.NewFilteredNetworkPolicyInformer(client, metav1.NamespaceAll, resync, indexers, tweakListOptions("networkpolicies"))
+	})
+	factory.InformerFor(&rbacv1.Role{}, func(client kubernetes.Interface, resync time.Duration) cache.SharedIndexInformer {
+		return rbacinformers.NewFilteredRoleInformer(client, metav1.NamespaceAll, resync, indexers, tweakListOptions("roles"))
+	})
+	factory.InformerFor(&rbacv1.ClusterRole{}, func(client kubernetes.Interface, resync time.Duration) cache.SharedIndexInformer {
+		return rbacinformers.NewFilteredClusterRoleInformer(client, resync, cache.Indexers{}, tweakListOptions("clusterroles"))
+	})
+	factory.InformerFor(&rbacv1.RoleBinding{}, func(client kubernetes.Interface, resync time.Duration) cache.SharedIndexInformer {
+		bindingIndexers := cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc, bindingSubjectIndex: indexBindingSubjects}
+		return rbacinformers.NewFilteredRoleBindingInformer(client, metav1.NamespaceAll, resync, bindingIndexers, tweakListOptions("rolebindings"))
+	})
+	factory.InformerFor(&rbacv1.ClusterRoleBinding{}, func(client kubernetes.Interface, resync time.Duration) cache.SharedIndexInformer {
+		return rbacinformers.NewFilteredClusterRoleBindingInformer(client, resync, cache.Indexers{bindingSubjectIndex: indexBindingSubjects}, tweakListOptions("clusterrolebindings"))
+	})
+	factory.InformerFor(&corev1.ServiceAccount{}, func(client kubernetes.Interface, resync time.Duration) cache.SharedIndexInformer {
+		return coreinformers.NewFilteredServiceAccountInformer(client, metav1.NamespaceAll, resync, indexers, tweakListOptions("serviceaccounts"))
+	})
+	factory.InformerFor(&corev1.PersistentVolume{}, func(client kubernetes.Interface, resync time.Duration) cache.SharedIndexInformer {
+		return coreinformers.NewFilteredPersistentVolumeInformer(client, resync, cache.Indexers{}, tweakListOptions("persistentvolumes"))
+	})
+	factory.InformerFor(&corev1.PersistentVolumeClaim{}, func(client kubernetes.Interface, resync time.Duration) cache.SharedIndexInformer {
+		return coreinformers.NewFilteredPersistentVolumeClaimInformer(client, metav1.NamespaceAll, resync, indexers, tweakListOptions("persistentvolumeclaims"))
+	})
+	factory.InformerFor(&storagev1.StorageClass{}, func(client kubernetes.Interface, resync time.Duration) cache.SharedIndexInformer {
+		return storageinformers.NewFilteredStorageClassInformer(client, resync, cache.Indexers{}, tweakListOptions("storageclasses"))
+	})
+}
+
+// waitForNamespaceScope waits until the namespaces that match the namespace selectors are known, so the watchers do
+// not collect objects of namespaces that are out of scope
+func (wh *WatchHandler) waitForNamespaceScope(ctx context.Context) {
+	if !wh.namespacesSelected {
+		return
+	}
+	informer := wh.informerFactory.Core().V1().Namespaces().Informer()
+	wh.informerFactory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		logger.L().Ctx(ctx).Warning("namespaces were not listed before the watch started", helpers.Error(ctx.Err()))
+	}
+}
+
+// isNamespaceSelected reports whether the namespace matches the namespace selectors. A namespace whose labels stop
+// matching is out of scope from then on, the objects already reported are not reported as deleted
+func (wh *WatchHandler) isNamespaceSelected(namespace string) bool {
+	if !wh.namespacesSelected {
+		return true
+	}
+	_, err := wh.informerFactory.Core().V1().Namespaces().Lister().Get(namespace)
+	return err == nil
+}
+
+// namespaceMatches matches a namespace against a glob, the empty pattern matches every namespace
+func namespaceMatches(pattern, namespace string) bool {
+	if pattern == "" {
+		return true
+	}
+	matched, _ := path.Match(pattern, namespace)
+	return matched
+}
@@ -0,0 +1,67 @@
+package watch
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParseNamespacePatterns(t *testing.T) {
+	t.Setenv(ExcludeNamespacesEnv, "kube-*, default")
+	patterns, err := parseNamespacePatterns(ExcludeNamespacesEnv)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"kube-*", "default"}, patterns)
+
+	t.Setenv(ExcludeNamespacesEnv, "kube-[")
+	_, err = parseNamespacePatterns(ExcludeNamespacesEnv)
+	assert.Error(t, err)
+}
+
+func TestIsNamespaceWatched(t *testing.T) {
+	wh := &WatchHandler{includeNamespaces: []string{"team-*", "default"}, excludeNamespaces: []string{"team-sandbox*"}}
+	assert.True(t, wh.isNamespaceWatched("default"))
+	assert.True(t, wh.isNamespaceWatched("team-payments"))
+	assert.False(t, wh.isNamespaceWatched("team-sandbox-1"))
+	assert.False(t, wh.isNamespaceWatched("kube-system"))
+}
+
+func TestNamespaceSelector(t *testing.T) {
+	t.Setenv("NAMESPACES_LABEL_SELECTOR", "kollector.io/ignore!=true")
+	assert.NoError(t, parseListSelectors())
+	client := fake.NewSimpleClientset(
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ignored", Labels: map[string]string{"kollector.io/ignore": "true"}}},
+	)
+	wh := &WatchHandler{
+		informerFactory:    newInformerFactory(client),
+		includeNamespaces:  []string{""},
+		namespacesSelected: isNamespaceSelectorSet(),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	wh.waitForNamespaceScope(ctx)
+	assert.True(t, wh.isNamespaceWatched("default"))
+	assert.False(t, wh.isNamespaceWatched("ignored"))
+
+	t.Setenv("PODS_LABEL_SELECTOR", "app in (")
+	assert.Error(t, parseListSelectors())
+}
+
+func TestScopedInformers(t *testing.T) {
+	t.Setenv("PODS_LABEL_SELECTOR", "app=web")
+	client := fake.NewSimpleClientset(
+		&core.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web", Labels: map[string]string{"app": "web"}}},
+		&core.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "db", Labels: map[string]string{"app": "db"}}},
+	)
+	factory := newInformerFactory(client)
+	informer := factory.Core().V1().Pods().Informer()
+	startInformers(t, factory, informer)
+
+	pods := informer.GetStore().ListKeys()
+	assert.Equal(t, []string{"default/web"}, pods)
+}
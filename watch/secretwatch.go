@@ -11,6 +11,7 @@ import (
 	"golang.org/x/net/context"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/watch"
 )
 
@@ -26,41 +27,46 @@ func (wh *WatchHandler) SecretWatch(ctx context.Context) {
 			logger.L().Ctx(ctx).Error("RECOVER SecretWatch", helpers.Interface("error", err), helpers.String("stack", string(debug.Stack())))
 		}
 	}()
-	var lastWatchEventCreationTime time.Time
-	newStateChan := make(chan bool)
-	wh.newStateReportChans = append(wh.newStateReportChans, newStateChan)
-WatchLoop:
+	newStateChan, unregister := wh.registerNewStateChan()
+	defer unregister()
+	logger.L().Info("Watching over secrets starting")
+	secrets := wh.watchInformer(ctx, "secrets", wh.informerFactory.Core().V1().Secrets().Informer())
+	reconcile, stopReconcile := newReconcileTicker()
+	defer stopReconcile()
 	for {
-		logger.L().Info("Watching over secrets starting")
-		secretsWatcher, err := wh.RestAPIClient.CoreV1().Secrets("").Watch(globalHTTPContext, metav1.ListOptions{Watch: true})
-		if err != nil {
-			time.Sleep(1 * time.Second)
-			continue
+		wh.handleSecretWatch(ctx, secrets, newStateChan, reconcile)
+		if ctx.Err() != nil {
+			return
 		}
-		secretsChan := secretsWatcher.ResultChan()
-		logger.L().Info("Watching over secrets started")
-	ChanLoop:
-		for {
-			var event watch.Event
-			select {
-			case event = <-secretsChan:
-			case <-newStateChan:
-				secretsWatcher.Stop()
-				continue WatchLoop
-			}
+		// the new first report starts from an empty state and reports every existing object again
+		wh.secretdm = newResourceMap()
+		secrets.replay()
+	}
+}
 
-			if event.Type == watch.Error {
-				secretsWatcher.Stop()
-				break ChanLoop
-			}
-			if err := wh.secretEventHandler(&event, lastWatchEventCreationTime); err != nil {
-				break ChanLoop
+func (wh *WatchHandler) handleSecretWatch(ctx context.Context, events *informerEvents, newStateChan <-chan bool, reconcile <-chan time.Time) {
+	logger.L().Info("Watching over secrets started")
+	for {
+		var event watch.Event
+		select {
+		case event = <-events.next():
+		case <-newStateChan:
+			return
+		case <-events.done(ctx):
+			if events.stop() {
+				continue
 			}
+			return
+		case <-reconcile:
+			wh.reconcileSecrets(ctx, events)
+			continue
+		}
+		if err := wh.secretEventHandler(&event); err != nil {
+			logger.L().Ctx(ctx).Error("failed to handle secret event", helpers.Error(err))
 		}
-		lastWatchEventCreationTime = time.Now()
 	}
 }
-func (wh *WatchHandler) secretEventHandler(event *watch.Event, lastWatchEventCreationTime time.Time) error {
+func (wh *WatchHandler) secretEventHandler(event *watch.Event) error {
 	if secret, ok := event.Object.(*corev1.Secret); ok {
 		if !wh.isNamespaceWatched(secret.Namespace) {
 			return nil
@@ -68,10 +74,7 @@ func (wh *WatchHandler) secretEventHandler(event *watch.Event, lastWatchEventCre
 		secret.ManagedFields = []metav1.ManagedFieldsEntry{}
 		removeSecretData(secret)
 		switch event.Type {
-		case "ADDED":
-			if secret.CreationTimestamp.Time.Before(lastWatchEventCreationTime) {
-				return nil
-			}
+		case watch.Added:
 			secretdm := secretData{Secret: secret}
 			id := CreateID()
 			wh.secretdm.init(id)
@@ -82,14 +85,10 @@ func (wh *WatchHandler) secretEventHandler(event *watch.Event, lastWatchEventCre
 			wh.updateSecret(secret)
 			informNewDataArrive(wh)
 			wh.jsonReport.AddToJsonFormat(secret, SECRETS, UPDATED)
-		case "DELETED":
+		case watch.Deleted:
 			wh.removeSecret(secret)
 			informNewDataArrive(wh)
 			wh.jsonReport.AddToJsonFormat(secret, SECRETS, DELETED)
-		case "BOOKMARK": //only the resource version is changed but it's the same workload
-			return nil
-		case "ERROR":
-			return fmt.Errorf("while watching over secrets we got an error")
 		}
 	} else {
 		return fmt.Errorf("got unexpected secret from chan")
@@ -149,6 +148,27 @@ func (wh *WatchHandler) removeSecret(secret *corev1.Secret) string {
 	}
 	return ""
 }
+
+// reconcileSecrets corrects the secrets the watch stream missed
+func (wh *WatchHandler) reconcileSecrets(ctx context.Context, events *informerEvents) {
+	reported := wh.secretdm.reportedVersions(func(value interface{}) metav1.Object {
+		if sd, ok := value.(secretData); ok && sd.Secret != nil {
+			return sd.Secret
+		}
+		return nil
+	})
+	secrets, err := wh.RestAPIClient.CoreV1().Secrets("").List(ctx, listOptions("secrets"))
+	if err != nil {
+		logger.L().Ctx(ctx).Error("failed to list secrets for reconcile", helpers.Error(err))
+		return
+	}
+	listed := make([]runtime.Object, 0, len(secrets.Items))
+	for i := range secrets.Items {
+		listed = append(listed, &secrets.Items[i])
+	}
+	wh.reconcile(ctx, events, reported, listed, wh.isObjectNamespaceWatched)
+}
+
 func removeSecretData(secret *corev1.Secret) {
 	secret.Data = nil
 	if secret.Annotations != nil {
@@ -0,0 +1,28 @@
+package watch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func TestSecretUpdates(t *testing.T) {
+	wh := &WatchHandler{informNewDataChannel: make(chan int, 1), secretdm: newResourceMap(), includeNamespaces: []string{""}}
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "db"}, Data: map[string][]byte{"password": []byte("secret")}}
+	updated := secret.DeepCopy()
+	updated.Labels = map[string]string{"rotated": "true"}
+
+	assert.NoError(t, wh.secretEventHandler(&watch.Event{Type: watch.Added, Object: secret}))
+	assert.NoError(t, wh.secretEventHandler(&watch.Event{Type: watch.Modified, Object: updated}))
+
+	// the informers' modifications keep the report output of the watch events, which never matched "MODIFY"
+	assert.Len(t, wh.jsonReport.Secret.Created, 1)
+	assert.Empty(t, wh.jsonReport.Secret.Updated)
+	assert.NoError(t, wh.secretEventHandler(&watch.Event{Type: "MODIFY", Object: updated}))
+	if assert.Len(t, wh.jsonReport.Secret.Updated, 1) {
+		assert.Equal(t, "true", wh.jsonReport.Secret.Updated[0].(*corev1.Secret).Labels["rotated"])
+	}
+}
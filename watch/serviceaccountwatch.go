@@ -0,0 +1,124 @@
+package watch
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sort"
+
+	logger "github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+	"golang.org/x/net/context"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// setServiceAccount sets the service account of a workload, whether its token is mounted and the image pull secrets
+// its pods use, from the service accounts watcher's cache
+func (wh *WatchHandler) setServiceAccount(microService *MicroServiceData) {
+	if microService.Pod == nil {
+		return
+	}
+	microService.ServiceAccountName = podServiceAccount(microService.Pod)
+	var serviceAccount *core.ServiceAccount
+	if wh.informerFactory != nil && wh.IsWatcherEnabled("serviceaccounts") {
+		serviceAccount, _ = wh.informerFactory.Core().V1().ServiceAccounts().Lister().ServiceAccounts(microService.Namespace).Get(microService.ServiceAccountName)
+	}
+	microService.AutomountServiceAccountToken = automountServiceAccountToken(&microService.Pod.Spec, serviceAccount)
+	microService.ImagePullSecrets = imagePullSecrets(&microService.Pod.Spec, serviceAccount)
+}
+
+// automountServiceAccountToken reports whether the token of the service account is mounted into the pods. The pod's
+// setting overrides the service account's, and the token is mounted when neither is set
+func automountServiceAccountToken(podSpec *core.PodSpec, serviceAccount *core.ServiceAccount) bool {
+	if podSpec.AutomountServiceAccountToken != nil {
+		return *podSpec.AutomountServiceAccountToken
+	}
+	if serviceAccount != nil && serviceAccount.AutomountServiceAccountToken != nil {
+		return *serviceAccount.AutomountServiceAccountToken
+	}
+	return true
+}
+
+// imagePullSecrets returns the names of the image pull secrets the pods use. Like the service account admission, the
+// service account's secrets are used only when the pods set none of their own
+func imagePullSecrets(podSpec *core.PodSpec, serviceAccount *core.ServiceAccount) []string {
+	references := podSpec.ImagePullSecrets
+	if len(references) == 0 && serviceAccount != nil {
+		references = serviceAccount.ImagePullSecrets
+	}
+	secrets := map[string]bool{}
+	for _, secret := range references {
+		secrets[secret.Name] = true
+	}
+	names := []string{}
+	for name := range secrets {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ServiceAccountWatch watch over service accounts
+func (wh *WatchHandler) ServiceAccountWatch(ctx context.Context) {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.L().Ctx(ctx).Error("RECOVER ServiceAccountWatch", helpers.Interface("error", err), helpers.String("stack", string(debug.Stack())))
+		}
+	}()
+	newStateChan, unregister := wh.registerNewStateChan()
+	defer unregister()
+	logger.L().Info("Watching over service accounts starting")
+	serviceAccounts := wh.watchInformer(ctx, "serviceaccounts", wh.informerFactory.Core().V1().ServiceAccounts().Informer())
+	for {
+		wh.handleServiceAccountWatch(ctx, serviceAccounts, newStateChan)
+		if ctx.Err() != nil {
+			return
+		}
+		// report every existing object again in the new first report
+		serviceAccounts.replay()
+	}
+}
+
+func (wh *WatchHandler) handleServiceAccountWatch(ctx context.Context, events *informerEvents, newStateChan <-chan bool) {
+	logger.L().Info("Watching over service accounts started")
+	for {
+		var event watch.Event
+		select {
+		case event = <-events.next():
+		case <-newStateChan:
+			return
+		case <-events.done(ctx):
+			if events.stop() {
+				continue
+			}
+			return
+		}
+		serviceAccount, ok := event.Object.(*core.ServiceAccount)
+		if !ok {
+			logger.L().Ctx(ctx).Error("failed to handle service account event", helpers.Error(fmt.Errorf("got unexpected service account from chan")))
+			continue
+		}
+		if !wh.isNamespaceWatched(serviceAccount.Namespace) {
+			continue
+		}
+		serviceAccount.ManagedFields = []metav1.ManagedFieldsEntry{}
+		switch event.Type {
+		case watch.Added:
+			informNewDataArrive(wh)
+			wh.jsonReport.AddToJsonFormat(serviceAccount, SERVICEACCOUNTS, CREATED)
+		case watch.Modified:
+			informNewDataArrive(wh)
+			wh.jsonReport.AddToJsonFormat(serviceAccount, SERVICEACCOUNTS, UPDATED)
+		case watch.Deleted:
+			informNewDataArrive(wh)
+			wh.jsonReport.AddToJsonFormat(serviceAccount, SERVICEACCOUNTS, DELETED)
+		}
+		wh.workloadsChanged(serviceAccount.Namespace)
+	}
+}
@@ -0,0 +1,59 @@
+package watch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestAutomountServiceAccountToken(t *testing.T) {
+	enabled, disabled := true, false
+	assert.True(t, automountServiceAccountToken(&core.PodSpec{}, nil))
+	assert.False(t, automountServiceAccountToken(&core.PodSpec{}, &core.ServiceAccount{AutomountServiceAccountToken: &disabled}))
+	assert.True(t, automountServiceAccountToken(&core.PodSpec{AutomountServiceAccountToken: &enabled}, &core.ServiceAccount{AutomountServiceAccountToken: &disabled}))
+	assert.False(t, automountServiceAccountToken(&core.PodSpec{AutomountServiceAccountToken: &disabled}, &core.ServiceAccount{AutomountServiceAccountToken: &enabled}))
+}
+
+func TestImagePullSecrets(t *testing.T) {
+	serviceAccount := &core.ServiceAccount{ImagePullSecrets: []core.LocalObjectReference{{Name: "registry"}, {Name: "mirror"}}}
+	podSpec := &core.PodSpec{ImagePullSecrets: []core.LocalObjectReference{{Name: "private"}, {Name: "private"}}}
+	assert.Equal(t, []string{"private"}, imagePullSecrets(podSpec, serviceAccount))
+	assert.Equal(t, []string{"mirror", "registry"}, imagePullSecrets(&core.PodSpec{}, serviceAccount))
+	assert.Nil(t, imagePullSecrets(&core.PodSpec{}, nil))
+}
+
+func TestSetServiceAccount(t *testing.T) {
+	disabled := false
+	client := fake.NewSimpleClientset(&core.ServiceAccount{
+		ObjectMeta:                   metav1.ObjectMeta{Namespace: "shop", Name: "builder"},
+		AutomountServiceAccountToken: &disabled,
+		ImagePullSecrets:             []core.LocalObjectReference{{Name: "registry"}, {Name: "mirror"}},
+	})
+	wh := &WatchHandler{informerFactory: newInformerFactory(client)}
+	startInformers(t, wh.informerFactory, wh.informerFactory.Core().V1().ServiceAccounts().Informer())
+
+	microService := MicroServiceData{Pod: &core.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "builder-1"},
+		Spec:       core.PodSpec{ServiceAccountName: "builder", ImagePullSecrets: []core.LocalObjectReference{{Name: "registry"}}},
+	}}
+	wh.setServiceAccount(&microService)
+	assert.Equal(t, "builder", microService.ServiceAccountName)
+	assert.False(t, microService.AutomountServiceAccountToken)
+	assert.Equal(t, []string{"registry"}, microService.ImagePullSecrets)
+
+	microService = MicroServiceData{Pod: &core.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "builder-2"},
+		Spec:       core.PodSpec{ServiceAccountName: "builder"},
+	}}
+	wh.setServiceAccount(&microService)
+	assert.Equal(t, []string{"mirror", "registry"}, microService.ImagePullSecrets)
+
+	microService = MicroServiceData{Pod: &core.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "web-1"}}}
+	wh.setServiceAccount(&microService)
+	assert.Equal(t, "default", microService.ServiceAccountName)
+	assert.True(t, microService.AutomountServiceAccountToken)
+	assert.Nil(t, microService.ImagePullSecrets)
+}
@@ -11,6 +11,7 @@ import (
 	"golang.org/x/net/context"
 	core "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/watch"
 )
 
@@ -25,18 +26,20 @@ func (wh *WatchHandler) ServiceWatch(ctx context.Context) {
 			logger.L().Ctx(ctx).Error("RECOVER ServiceWatch", helpers.Interface("error", err), helpers.String("stack", string(debug.Stack())))
 		}
 	}()
-	var lastWatchEventCreationTime time.Time
-	newStateChan := make(chan bool)
-	wh.newStateReportChans = append(wh.newStateReportChans, newStateChan)
+	newStateChan, unregister := wh.registerNewStateChan()
+	defer unregister()
+	logger.L().Info("Watching over services starting")
+	services := wh.watchInformer(ctx, "services", wh.informerFactory.Core().V1().Services().Informer())
+	reconcile, stopReconcile := newReconcileTicker()
+	defer stopReconcile()
 	for {
-		logger.L().Info("Watching over services starting")
-		serviceWatcher, err := wh.RestAPIClient.CoreV1().Services("").Watch(globalHTTPContext, metav1.ListOptions{Watch: true})
-		if err != nil {
-			time.Sleep(1 * time.Second)
-			lastWatchEventCreationTime = time.Now()
-			continue
+		wh.handleServiceWatch(ctx, services, newStateChan, reconcile)
+		if ctx.Err() != nil {
+			return
 		}
-		wh.handleServiceWatch(serviceWatcher, newStateChan, &lastWatchEventCreationTime)
+		// the new first report starts from an empty state and reports every existing object again
+		wh.sdm = make(map[int]*list.List)
+		services.replay()
 	}
 }
 func updateService(service *core.Service, sdm map[int]*list.List) string {
@@ -76,21 +79,22 @@ func removeService(service *core.Service, sdm map[int]*list.List) string {
 	return ""
 }
 
-func (wh *WatchHandler) handleServiceWatch(serviceWatcher watch.Interface, newStateChan <-chan bool, lastWatchEventCreationTime *time.Time) {
-	serviceChan := serviceWatcher.ResultChan()
+func (wh *WatchHandler) handleServiceWatch(ctx context.Context, events *informerEvents, newStateChan <-chan bool, reconcile <-chan time.Time) {
 	logger.L().Info("Watching over services started")
 	for {
 		var event watch.Event
 		select {
-		case event = <-serviceChan:
+		case event = <-events.next():
 		case <-newStateChan:
-			serviceWatcher.Stop()
-			*lastWatchEventCreationTime = time.Now()
 			return
-		}
-		if event.Type == watch.Error {
-			*lastWatchEventCreationTime = time.Now()
+		case <-events.done(ctx):
+			if events.stop() {
+				continue
+			}
 			return
+		case <-reconcile:
+			wh.reconcileServices(ctx, events)
+			continue
 		}
 		if service, ok := event.Object.(*core.Service); ok {
 			if !wh.isNamespaceWatched(service.Namespace) {
@@ -98,10 +102,7 @@ func (wh *WatchHandler) handleServiceWatch(serviceWatcher watch.Interface, newSt
 			}
 			service.ManagedFields = []metav1.ManagedFieldsEntry{}
 			switch event.Type {
-			case "ADDED":
-				if service.CreationTimestamp.Time.Before(*lastWatchEventCreationTime) {
-					continue
-				}
+			case watch.Added:
 				id := CreateID()
 				if wh.sdm[id] == nil {
 					wh.sdm[id] = list.New()
@@ -114,19 +115,31 @@ func (wh *WatchHandler) handleServiceWatch(serviceWatcher watch.Interface, newSt
 				updateService(service, wh.sdm)
 				informNewDataArrive(wh)
 				wh.jsonReport.AddToJsonFormat(service, SERVICES, UPDATED)
-			case "DELETED":
+			case watch.Deleted:
 				removeService(service, wh.sdm)
 				informNewDataArrive(wh)
 				wh.jsonReport.AddToJsonFormat(service, SERVICES, DELETED)
-			case "BOOKMARK": //only the resource version is changed but it's the same workload
-				continue
-			case "ERROR":
-				*lastWatchEventCreationTime = time.Now()
-				return
 			}
-		} else {
-			*lastWatchEventCreationTime = time.Now()
-			return
 		}
 	}
 }
+
+// reconcileServices corrects the services the watch stream missed
+func (wh *WatchHandler) reconcileServices(ctx context.Context, events *informerEvents) {
+	reported := reportedVersions(wh.sdm, func(value interface{}) metav1.Object {
+		if sd, ok := value.(serviceData); ok && sd.Service != nil {
+			return sd.Service
+		}
+		return nil
+	})
+	services, err := wh.RestAPIClient.CoreV1().Services("").List(ctx, listOptions("services"))
+	if err != nil {
+		logger.L().Ctx(ctx).Error("failed to list services for reconcile", helpers.Error(err))
+		return
+	}
+	listed := make([]runtime.Object, 0, len(services.Items))
+	for i := range services.Items {
+		listed = append(listed, &services.Items[i])
+	}
+	wh.reconcile(ctx, events, reported, listed, wh.isObjectNamespaceWatched)
+}
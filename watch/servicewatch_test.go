@@ -0,0 +1,42 @@
+package watch
+
+import (
+	"container/list"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func TestServiceUpdates(t *testing.T) {
+	wh := &WatchHandler{informNewDataChannel: make(chan int, 1), sdm: make(map[int]*list.List), includeNamespaces: []string{""}}
+	service := &core.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "web"}}
+	unchanged := service.DeepCopy()
+	updated := service.DeepCopy()
+	updated.Spec.Ports = []core.ServicePort{{Port: 8080}}
+
+	services := newInformerEvents("services", nil, nil)
+	newStateChan := make(chan bool)
+	done := make(chan struct{})
+	go func() {
+		wh.handleServiceWatch(context.Background(), services, newStateChan, nil)
+		close(done)
+	}()
+	services.events <- watch.Event{Type: watch.Added, Object: service}
+	// the informers' modifications keep the report output of the watch events, which never matched "MODIFY"
+	services.events <- watch.Event{Type: watch.Modified, Object: unchanged}
+	services.events <- watch.Event{Type: "MODIFY", Object: updated}
+	newStateChan <- true
+	<-done
+
+	assert.Len(t, wh.jsonReport.Services.Created, 1)
+	assert.Equal(t, []interface{}{updated}, wh.jsonReport.Services.Updated)
+	var reported []*core.Service
+	for _, v := range wh.sdm {
+		reported = append(reported, v.Front().Value.(serviceData).Service)
+	}
+	assert.Equal(t, []*core.Service{updated}, reported)
+}
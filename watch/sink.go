@@ -0,0 +1,283 @@
+package watch
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/armosec/utils-k8s-go/armometadata"
+	logger "github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+)
+
+const (
+	ReportSinkEnv          = "REPORT_SINK"
+	ReportFilePathEnv      = "REPORT_FILE_PATH"
+	ShutdownGracePeriodEnv = "SHUTDOWN_GRACE_PERIOD"
+)
+
+const (
+	websocketSinkType = "websocket"
+	httpSinkType      = "http"
+	fileSinkType      = "file"
+	stdoutSinkType    = "stdout"
+)
+
+// ReportSink is a destination of the cluster reports
+type ReportSink interface {
+	// Send queues the report with sequence number seq, first tells whether it is a first report. It must not block on
+	// the destination
+	Send(seq uint64, report []byte, first bool)
+	// Run delivers the queued reports until ctx is done or the destination fails for good.
+	// resync is called with true whenever the destination needs a new first report
+	Run(ctx context.Context, isServerReady *atomic.Bool, resync func(bool)) error
+	// Flush waits until the queued reports are delivered, or until ctx is done
+	Flush(ctx context.Context) error
+}
+
+// ShutdownGracePeriod is the time the sinks have to deliver the queued reports on shutdown
+func ShutdownGracePeriod() time.Duration {
+	return time.Duration(getNumericValueFromEnvVar(ShutdownGracePeriodEnv, 25)) * time.Second
+}
+
+// spooledSink is implemented by the sinks that keep undelivered reports across restarts
+type spooledSink interface {
+	lastSequence() uint64
+}
+
+// createReportSink creates the destinations listed in the REPORT_SINK environment variable.
+// Every comma separated entry is a sink type, optionally followed by "=" and the target of the sink (URL or file path)
+func createReportSink(config *armometadata.ClusterConfig, tlsConfig *tls.Config, tokens tokenSource) (ReportSink, error) {
+	destinations := strings.Split(os.Getenv(ReportSinkEnv), ",")
+	sinks := make([]ReportSink, 0, len(destinations))
+	spools := map[string]bool{}
+	for _, destination := range destinations {
+		sinkType, target, _ := strings.Cut(strings.TrimSpace(destination), "=")
+		name := spoolName(sinkType, target)
+		if spools[name] {
+			return nil, fmt.Errorf("report sink '%s' is listed twice", strings.TrimSpace(destination))
+		}
+		spools[name] = true
+		sink, err := createSink(config, tlsConfig, tokens, sinkType, target, name)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	if len(sinks) == 1 {
+		return sinks[0], nil
+	}
+	return newMultiSink(sinks), nil
+}
+
+// spoolName names the spool of a destination after its type and target, so reordering the destinations keeps every
+// destination on its own spool
+func spoolName(sinkType, target string) string {
+	if sinkType == "" {
+		sinkType = websocketSinkType
+	}
+	if target == "" {
+		return sinkType
+	}
+	hash := sha256.Sum256([]byte(target))
+	return fmt.Sprintf("%s-%s", sinkType, hex.EncodeToString(hash[:8]))
+}
+
+func createSink(config *armometadata.ClusterConfig, tlsConfig *tls.Config, tokens tokenSource, sinkType, target, name string) (ReportSink, error) {
+	logger.L().Info("creating report sink", helpers.String("type", sinkType), helpers.String("target", target))
+	if target != "" {
+		// the access token authenticates kollector to the event receiver only, it is not sent to other destinations
+		tokens = nil
+	} else {
+		tlsConfig = eventReceiverTLSConfig(tlsConfig)
+	}
+	switch sinkType {
+	case "", websocketSinkType:
+		if target == "" {
+			target = config.EventReceiverWebsocketURL
+		}
+		erURL, err := setWebSocketURL(target, config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set event receiver url: %s", err.Error())
+		}
+		return createWebSocketHandler(erURL, createReportSpool(name), tlsConfig, tokens), nil
+	case httpSinkType:
+		restURL, err := setRestURL(config)
+		if target != "" {
+			restURL, err = url.Parse(target)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to set event receiver url: %s", err.Error())
+		}
+		return newHTTPSink(restURL, createReportSpool(name), tlsConfig, tokens), nil
+	case fileSinkType:
+		if target == "" {
+			target = os.Getenv(ReportFilePathEnv)
+		}
+		if target == "" {
+			return nil, fmt.Errorf("%s must be set for the %s report sink", ReportFilePathEnv, fileSinkType)
+		}
+		return newFileSink(target)
+	case stdoutSinkType:
+		return newWriterSink(os.Stdout), nil
+	}
+	return nil, fmt.Errorf("unknown report sink '%s'", sinkType)
+}
+
+// createReportSpool creates the spool of a single destination in its own directory under SPOOL_DIR
+func createReportSpool(name string) *reportSpool {
+	dir := os.Getenv(SpoolDirEnv)
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "kollector-spool")
+	}
+	dir = filepath.Join(dir, name)
+	maxBytes := int64(getNumericValueFromEnvVar(SpoolMaxSizeEnv, 100*1024*1024))
+	maxAge := time.Duration(getNumericValueFromEnvVar(SpoolMaxAgeEnv, 3600)) * time.Second
+	spool, err := newReportSpool(dir, maxBytes, maxAge)
+	if err != nil {
+		logger.L().Error("failed to create report spool, reports will be kept in memory only", helpers.String("dir", dir), helpers.Error(err))
+		spool, _ = newReportSpool("", maxBytes, maxAge)
+	}
+	return spool
+}
+
+// multiSink fans the reports out to several destinations. Every destination keeps its own queue, retry state and
+// first report state, so a slow or failing destination does not hold back the others
+type multiSink struct {
+	sinks []ReportSink
+	// firstReportPending is set for the destinations that asked for a first report until they get one
+	firstReportPending []atomic.Bool
+}
+
+func newMultiSink(sinks []ReportSink) *multiSink {
+	return &multiSink{sinks: sinks, firstReportPending: make([]atomic.Bool, len(sinks))}
+}
+
+// Send queues the report in every destination. A first report that only some destinations asked for is only queued in
+// them, the others are in sync and keep their state
+func (sink *multiSink) Send(seq uint64, report []byte, first bool) {
+	requested := false
+	if first {
+		for i := range sink.firstReportPending {
+			requested = requested || sink.firstReportPending[i].Load()
+		}
+	}
+	for i := range sink.sinks {
+		if requested && !sink.firstReportPending[i].Swap(false) {
+			continue
+		}
+		sink.sinks[i].Send(seq, report, first)
+	}
+}
+
+// Run runs every destination and returns once all of them stopped. The server is ready while any destination is ready
+func (sink *multiSink) Run(ctx context.Context, isServerReady *atomic.Bool, resync func(bool)) error {
+	ready := make([]atomic.Bool, len(sink.sinks))
+	errs := make([]error, len(sink.sinks))
+	wg := sync.WaitGroup{}
+	for i := range sink.sinks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = sink.sinks[i].Run(ctx, &ready[i], func(first bool) {
+				if first {
+					sink.firstReportPending[i].Store(true)
+				}
+				resync(first)
+			})
+			logger.L().Ctx(ctx).Error("report sink stopped", helpers.Int("sink", i), helpers.Error(errs[i]))
+		}(i)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			isServerReady.Store(false)
+			for i := range errs {
+				if errs[i] != nil {
+					return errs[i]
+				}
+			}
+			return fmt.Errorf("all report sinks stopped")
+		case <-ticker.C:
+			anyReady := false
+			for i := range ready {
+				anyReady = anyReady || ready[i].Load()
+			}
+			isServerReady.Store(anyReady)
+		}
+	}
+}
+
+// Flush flushes every destination at the same time
+func (sink *multiSink) Flush(ctx context.Context) error {
+	errs := make([]error, len(sink.sinks))
+	wg := sync.WaitGroup{}
+	for i := range sink.sinks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = sink.sinks[i].Flush(ctx)
+		}(i)
+	}
+	wg.Wait()
+	for i := range errs {
+		if errs[i] != nil {
+			return fmt.Errorf("report sink %d: %w", i, errs[i])
+		}
+	}
+	return nil
+}
+
+func (sink *multiSink) setCommandHandler(handler commandHandler) {
+	for i := range sink.sinks {
+		if commands, ok := sink.sinks[i].(commandSink); ok {
+			commands.setCommandHandler(handler)
+		}
+	}
+}
+
+func (sink *multiSink) lastSequence() uint64 {
+	var last uint64
+	for i := range sink.sinks {
+		if spooled, ok := sink.sinks[i].(spooledSink); ok && spooled.lastSequence() > last {
+			last = spooled.lastSequence()
+		}
+	}
+	return last
+}
+
+// Send queues a report for the websocket
+func (wsh *WebSocketHandler) Send(seq uint64, report []byte, first bool) {
+	wsh.spool.push(seq, report, first)
+}
+
+// Run sends the reports over the websocket
+func (wsh *WebSocketHandler) Run(ctx context.Context, isServerReady *atomic.Bool, resync func(bool)) error {
+	return wsh.SendReportRoutine(ctx, isServerReady, resync)
+}
+
+// Flush waits until the spooled reports are written, or acknowledged when acknowledgements are enabled
+func (wsh *WebSocketHandler) Flush(ctx context.Context) error {
+	return wsh.spool.flush(ctx)
+}
+
+func (wsh *WebSocketHandler) lastSequence() uint64 {
+	return wsh.spool.lastSequence()
+}
@@ -0,0 +1,171 @@
+package watch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/armosec/utils-k8s-go/armometadata"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriterSink(t *testing.T) {
+	buf := &bytes.Buffer{}
+	sink := newWriterSink(buf)
+	report := make([]byte, 0, 64)
+	report = append(report, `{"firstReport":true}`...)
+	sink.Send(1, report, true)
+	sink.Send(2, []byte(`{"firstReport":false}`), false)
+	assert.Equal(t, "{\"firstReport\":true}\n{\"firstReport\":false}\n", buf.String())
+	// the report is shared with the other destinations, its spare capacity is left intact
+	assert.Equal(t, byte(0), report[:len(report)+1][len(report)])
+}
+
+func TestHTTPSink(t *testing.T) {
+	mutex := sync.Mutex{}
+	batches := [][]map[string]interface{}{}
+	failures := 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		batch := []map[string]interface{}{}
+		assert.NoError(t, json.Unmarshal(body, &batch))
+		batches = append(batches, batch)
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	spool, _ := newReportSpool("", 0, 0)
+	sink := newHTTPSink(u, spool, nil, nil)
+	sink.backoff = newBackoff(time.Millisecond, time.Millisecond)
+	sink.Send(1, []byte(`{"sequenceNumber":1}`), true)
+	sink.Send(2, []byte(`{"sequenceNumber":2}`), false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var isServerReady atomic.Bool
+	go sink.Run(ctx, &isServerReady, func(bool) {})
+
+	assert.Eventually(t, func() bool { return sink.spool.len() == 0 }, time.Second, time.Millisecond)
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Len(t, batches, 1)
+	assert.Len(t, batches[0], 2)
+}
+
+func TestMultiSink(t *testing.T) {
+	first, second := &bytes.Buffer{}, &bytes.Buffer{}
+	sink := newMultiSink([]ReportSink{newWriterSink(first), newWriterSink(second)})
+	sink.Send(1, []byte(`{"firstReport":true}`), true)
+	assert.Equal(t, "{\"firstReport\":true}\n", first.String())
+	assert.Equal(t, first.String(), second.String())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var isServerReady atomic.Bool
+	done := make(chan error)
+	go func() { done <- sink.Run(ctx, &isServerReady, func(bool) {}) }()
+	assert.Eventually(t, isServerReady.Load, 3*time.Second, 10*time.Millisecond)
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
+
+// resyncSink records the reports it is sent and asks for a first report when told to
+type resyncSink struct {
+	bytes.Buffer
+	resync chan struct{}
+}
+
+func (sink *resyncSink) Send(seq uint64, report []byte, first bool) {
+	sink.Write(report)
+	sink.WriteByte('\n')
+}
+
+func (sink *resyncSink) Run(ctx context.Context, isServerReady *atomic.Bool, resync func(bool)) error {
+	isServerReady.Store(true)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-sink.resync:
+			resync(true)
+		}
+	}
+}
+
+func (sink *resyncSink) Flush(ctx context.Context) error {
+	return nil
+}
+
+func TestMultiSinkFirstReport(t *testing.T) {
+	reconnected, inSync := &resyncSink{resync: make(chan struct{})}, &resyncSink{resync: make(chan struct{})}
+	sink := newMultiSink([]ReportSink{reconnected, inSync})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	requests := make(chan bool, 1)
+	var isServerReady atomic.Bool
+	go sink.Run(ctx, &isServerReady, func(first bool) { requests <- first })
+
+	reconnected.resync <- struct{}{}
+	assert.True(t, <-requests)
+	sink.Send(1, []byte(`{"firstReport":true,"node":{}}`), true)
+	sink.Send(2, []byte(`{"firstReport":false}`), false)
+	// only the destination that asked for it gets the first report, the other one is in sync and keeps its state
+	assert.Equal(t, "{\"firstReport\":true,\"node\":{}}\n{\"firstReport\":false}\n", reconnected.String())
+	assert.Equal(t, "{\"firstReport\":false}\n", inSync.String())
+
+	// a first report nobody asked for, e.g. a resync command, goes to every destination
+	sink.Send(3, []byte(`{"firstReport":true}`), true)
+	assert.Contains(t, inSync.String(), "{\"firstReport\":true}\n")
+}
+
+func TestSpoolName(t *testing.T) {
+	assert.Equal(t, "websocket", spoolName("", ""))
+	assert.Equal(t, "http", spoolName(httpSinkType, ""))
+	assert.Equal(t, spoolName(httpSinkType, "https://cmdb.example.com/reports"), spoolName(httpSinkType, "https://cmdb.example.com/reports"))
+	assert.NotEqual(t, spoolName(httpSinkType, "https://cmdb.example.com/reports"), spoolName(httpSinkType, "https://backup.example.com/reports"))
+}
+
+func TestCreateReportSink(t *testing.T) {
+	t.Setenv(SpoolDirEnv, t.TempDir())
+	t.Setenv(ReportSinkEnv, "stdout, file="+t.TempDir()+"/reports.ndjson, http=https://cmdb.example.com/reports")
+	sink, err := createReportSink(&armometadata.ClusterConfig{}, nil, nil)
+	assert.NoError(t, err)
+	multi, ok := sink.(*multiSink)
+	assert.True(t, ok)
+	assert.Len(t, multi.sinks, 3)
+	assert.Equal(t, "cmdb.example.com", multi.sinks[2].(*httpSink).u.Host)
+
+	t.Setenv(ReportSinkEnv, "http=https://cmdb.example.com/reports,http=https://cmdb.example.com/reports")
+	_, err = createReportSink(&armometadata.ClusterConfig{}, nil, nil)
+	assert.Error(t, err)
+
+	t.Setenv(ReportSinkEnv, "carrier-pigeon")
+	_, err = createReportSink(&armometadata.ClusterConfig{}, nil, nil)
+	assert.Error(t, err)
+}
+
+func TestCreateReportSinkCredentials(t *testing.T) {
+	t.Setenv(SpoolDirEnv, t.TempDir())
+	t.Setenv(ReportSinkEnv, "http, http=https://cmdb.example.com/reports, websocket=wss://cmdb.example.com")
+	tokens := &fileTokenSource{path: "/var/run/secrets/token"}
+	sink, err := createReportSink(&armometadata.ClusterConfig{EventReceiverRestURL: "https://er.example.com"}, nil, tokens)
+	assert.NoError(t, err)
+	multi := sink.(*multiSink)
+	assert.Equal(t, tokens, multi.sinks[0].(*httpSink).tokens)
+	assert.Nil(t, multi.sinks[1].(*httpSink).tokens)
+	assert.Nil(t, multi.sinks[2].(*WebSocketHandler).tokens)
+}
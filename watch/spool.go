@@ -0,0 +1,320 @@
+package watch
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	logger "github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+)
+
+const (
+	spoolSegmentSuffix = ".report"
+	// firstReportSegmentMark marks the segments of the first reports, e.g. 00000000000000000042.first.report
+	firstReportSegmentMark = ".first"
+)
+
+// spoolSegment is a single spooled report
+type spoolSegment struct {
+	seq     uint64
+	size    int64
+	created time.Time
+	// sentAt is set while the report waits for an acknowledgement
+	sentAt time.Time
+	// data is set only when the segment is not stored on disk
+	data []byte
+	// first is set when the report is a first report, it replaces every report before it
+	first bool
+}
+
+// reportSpool is a bounded FIFO of reports waiting for delivery. Every report is stored in its own segment file
+// under dir, so undelivered reports survive restarts and the oldest ones can be evicted once a limit is hit.
+// A report stays in the spool after it was sent until it is acknowledged
+type reportSpool struct {
+	dir      string
+	maxBytes int64
+	maxAge   time.Duration
+
+	mutex    sync.Mutex
+	segments []spoolSegment // oldest first
+	size     int64
+	lastSeq  uint64
+	notEmpty chan struct{}
+	// evicted is called when undelivered reports were evicted, the destination needs a new first report
+	evicted func()
+	// firstReportRequested is set from the time evicted was called until a first report is pushed
+	firstReportRequested bool
+}
+
+// newReportSpool creates a spool in dir and loads the segments left there by a previous run.
+// An empty dir keeps the reports in memory only
+func newReportSpool(dir string, maxBytes int64, maxAge time.Duration) (*reportSpool, error) {
+	spool := &reportSpool{
+		dir:      dir,
+		maxBytes: maxBytes,
+		maxAge:   maxAge,
+		notEmpty: make(chan struct{}, 1),
+	}
+	if dir == "" {
+		return spool, nil
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %w", err)
+	}
+	if err := spool.load(); err != nil {
+		return nil, err
+	}
+	spool.evict()()
+	if len(spool.segments) > 0 {
+		logger.L().Info("loaded undelivered reports from spool", helpers.String("dir", dir), helpers.Int("reports", len(spool.segments)))
+		spool.signal()
+	}
+	return spool, nil
+}
+
+func (spool *reportSpool) load() error {
+	entries, err := os.ReadDir(spool.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read spool directory: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), spoolSegmentSuffix) {
+			continue
+		}
+		name := strings.TrimSuffix(entry.Name(), spoolSegmentSuffix)
+		first := strings.HasSuffix(name, firstReportSegmentMark)
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, firstReportSegmentMark), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		spool.segments = append(spool.segments, spoolSegment{seq: seq, size: info.Size(), created: info.ModTime(), first: first})
+		spool.size += info.Size()
+		if seq > spool.lastSeq {
+			spool.lastSeq = seq
+		}
+	}
+	sort.Slice(spool.segments, func(i, j int) bool { return spool.segments[i].seq < spool.segments[j].seq })
+	return nil
+}
+
+// segmentPath names the segment file after the sequence number of its report, and marks the first reports so they
+// are known as such when the spool is loaded again
+func (spool *reportSpool) segmentPath(segment *spoolSegment) string {
+	mark := ""
+	if segment.first {
+		mark = firstReportSegmentMark
+	}
+	return filepath.Join(spool.dir, fmt.Sprintf("%020d%s%s", segment.seq, mark, spoolSegmentSuffix))
+}
+
+// push appends the report with sequence number seq to the spool, first tells whether it is a first report. If the
+// report cannot be persisted it is kept in memory
+func (spool *reportSpool) push(seq uint64, data []byte, first bool) {
+	spool.mutex.Lock()
+	segment := spoolSegment{seq: seq, size: int64(len(data)), created: time.Now(), first: first}
+	if segment.first {
+		spool.firstReportRequested = false
+	}
+	if seq > spool.lastSeq {
+		spool.lastSeq = seq
+	}
+	if spool.dir == "" {
+		segment.data = data
+	} else if err := spool.write(&segment, data); err != nil {
+		logger.L().Error("failed to persist report, keeping it in memory", helpers.Error(err))
+		segment.data = data
+	}
+	spool.segments = append(spool.segments, segment)
+	spool.size += segment.size
+	requestFirstReport := spool.evict()
+	spool.signal()
+	spool.mutex.Unlock()
+	requestFirstReport()
+}
+
+func (spool *reportSpool) write(segment *spoolSegment, data []byte) error {
+	// write to a temporary file first so a crash never leaves a partial segment behind
+	tmp := spool.segmentPath(segment) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, spool.segmentPath(segment))
+}
+
+// next returns the oldest report that was not sent yet and marks it as sent
+func (spool *reportSpool) next() (uint64, []byte, bool) {
+	spool.mutex.Lock()
+	requestFirstReport := spool.evict()
+	spool.mutex.Unlock()
+	requestFirstReport()
+
+	spool.mutex.Lock()
+	defer spool.mutex.Unlock()
+	for i := 0; i < len(spool.segments); {
+		segment := &spool.segments[i]
+		if !segment.sentAt.IsZero() {
+			i++
+			continue
+		}
+		data := segment.data
+		if data == nil {
+			var err error
+			if data, err = os.ReadFile(spool.segmentPath(segment)); err != nil {
+				logger.L().Error("failed to read spooled report, dropping it", helpers.Error(err))
+				spool.remove(i)
+				continue
+			}
+		}
+		segment.sentAt = time.Now()
+		return segment.seq, data, true
+	}
+	return 0, nil, false
+}
+
+// ack removes the report with sequence number seq once it was delivered
+func (spool *reportSpool) ack(seq uint64) bool {
+	spool.mutex.Lock()
+	defer spool.mutex.Unlock()
+
+	for i := range spool.segments {
+		if spool.segments[i].seq == seq {
+			spool.remove(i)
+			return true
+		}
+	}
+	return false
+}
+
+// rewind marks every unacknowledged report as not sent, so it is sent again over a new connection
+func (spool *reportSpool) rewind() {
+	spool.mutex.Lock()
+	defer spool.mutex.Unlock()
+
+	for i := range spool.segments {
+		spool.segments[i].sentAt = time.Time{}
+	}
+	if len(spool.segments) > 0 {
+		spool.signal()
+	}
+}
+
+// oldestUnacknowledged returns the time the oldest report that waits for an acknowledgement was sent
+func (spool *reportSpool) oldestUnacknowledged() (time.Time, bool) {
+	spool.mutex.Lock()
+	defer spool.mutex.Unlock()
+
+	var oldest time.Time
+	for i := range spool.segments {
+		sentAt := spool.segments[i].sentAt
+		if !sentAt.IsZero() && (oldest.IsZero() || sentAt.Before(oldest)) {
+			oldest = sentAt
+		}
+	}
+	return oldest, !oldest.IsZero()
+}
+
+// lastSequence returns the highest sequence number ever pushed to the spool
+func (spool *reportSpool) lastSequence() uint64 {
+	spool.mutex.Lock()
+	defer spool.mutex.Unlock()
+	return spool.lastSeq
+}
+
+func (spool *reportSpool) len() int {
+	spool.mutex.Lock()
+	defer spool.mutex.Unlock()
+	return len(spool.segments)
+}
+
+// flush waits until every report is acknowledged, or until ctx is done
+func (spool *reportSpool) flush(ctx context.Context) error {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		pending := spool.len()
+		if pending == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d reports were not delivered: %w", pending, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// setEvictHandler sets the function called whenever undelivered reports are evicted, it must not block
+func (spool *reportSpool) setEvictHandler(handler func()) {
+	spool.mutex.Lock()
+	defer spool.mutex.Unlock()
+	spool.evicted = handler
+}
+
+// ready is signalled whenever new reports were pushed
+func (spool *reportSpool) ready() <-chan struct{} {
+	return spool.notEmpty
+}
+
+func (spool *reportSpool) signal() {
+	select {
+	case spool.notEmpty <- struct{}{}:
+	default:
+	}
+}
+
+// evict drops the oldest reports while the spool exceeds its size or age limits. The newest report is always kept.
+// It returns the function that asks for a new first report, the caller calls it once it released the mutex
+func (spool *reportSpool) evict() func() {
+	evicted := 0
+	for len(spool.segments) > 1 && spool.maxBytes > 0 && spool.size > spool.maxBytes {
+		spool.remove(0)
+		evicted++
+	}
+	for len(spool.segments) > 0 && spool.maxAge > 0 && time.Since(spool.segments[0].created) > spool.maxAge {
+		spool.remove(0)
+		evicted++
+	}
+	if evicted == 0 {
+		return func() {}
+	}
+	logger.L().Warning("evicted undelivered reports from spool", helpers.Int("reports", evicted))
+	return spool.requestFirstReport()
+}
+
+// requestFirstReport returns the function that asks for a new first report after reports were evicted, the reports
+// that follow them miss their changes. Nothing is requested while a first report that replaces the evicted reports is
+// spooled or was requested
+func (spool *reportSpool) requestFirstReport() func() {
+	for i := range spool.segments {
+		if spool.segments[i].first {
+			return func() {}
+		}
+	}
+	if spool.evicted == nil || spool.firstReportRequested {
+		return func() {}
+	}
+	spool.firstReportRequested = true
+	return spool.evicted
+}
+
+func (spool *reportSpool) remove(i int) {
+	segment := spool.segments[i]
+	spool.segments = append(spool.segments[:i], spool.segments[i+1:]...)
+	spool.size -= segment.size
+	if segment.data == nil {
+		if err := os.Remove(spool.segmentPath(&segment)); err != nil && !os.IsNotExist(err) {
+			logger.L().Error("failed to remove spooled report", helpers.Error(err))
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package watch
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReportSpoolOrder(t *testing.T) {
+	spool, err := newReportSpool(t.TempDir(), 0, 0)
+	assert.NoError(t, err)
+
+	spool.push(1, []byte("first"), false)
+	spool.push(2, []byte("second"), false)
+	assert.Equal(t, 2, spool.len())
+
+	seq, data, ok := spool.next()
+	assert.True(t, ok)
+	assert.Equal(t, uint64(1), seq)
+	assert.Equal(t, "first", string(data))
+
+	seq, data, ok = spool.next()
+	assert.True(t, ok)
+	assert.Equal(t, uint64(2), seq)
+	assert.Equal(t, "second", string(data))
+
+	_, _, ok = spool.next()
+	assert.False(t, ok)
+}
+
+func TestReportSpoolAck(t *testing.T) {
+	spool, err := newReportSpool("", 0, 0)
+	assert.NoError(t, err)
+	spool.push(1, []byte("first"), false)
+	spool.push(2, []byte("second"), false)
+	spool.next()
+	spool.next()
+
+	_, ok := spool.oldestUnacknowledged()
+	assert.True(t, ok)
+	assert.True(t, spool.ack(2))
+	assert.False(t, spool.ack(2))
+	assert.Equal(t, 1, spool.len())
+
+	// unacknowledged reports are sent again after a reconnection
+	spool.rewind()
+	_, ok = spool.oldestUnacknowledged()
+	assert.False(t, ok)
+	seq, data, ok := spool.next()
+	assert.True(t, ok)
+	assert.Equal(t, uint64(1), seq)
+	assert.Equal(t, "first", string(data))
+}
+
+func TestReportSpoolSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	spool, err := newReportSpool(dir, 0, 0)
+	assert.NoError(t, err)
+	spool.push(1, []byte("first"), false)
+	spool.push(2, []byte("second"), false)
+	seq, _, _ := spool.next()
+	spool.ack(seq)
+
+	restarted, err := newReportSpool(dir, 0, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, restarted.len())
+	assert.Equal(t, uint64(2), restarted.lastSequence())
+	_, data, ok := restarted.next()
+	assert.True(t, ok)
+	assert.Equal(t, "second", string(data))
+
+	restarted.push(3, []byte("third"), false)
+	_, data, _ = restarted.next()
+	assert.Equal(t, "third", string(data))
+}
+
+func TestReportSpoolKeepsFirstReportsAcrossRestarts(t *testing.T) {
+	dir := t.TempDir()
+	spool, err := newReportSpool(dir, 0, 0)
+	assert.NoError(t, err)
+	spool.push(1, []byte(`{"firstReport":true}`), true)
+	spool.push(2, []byte(`{"firstReport":false}`), false)
+
+	restarted, err := newReportSpool(dir, 0, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, restarted.segments, 2) {
+		assert.True(t, restarted.segments[0].first)
+		assert.False(t, restarted.segments[1].first)
+	}
+	seq, data, _ := restarted.next()
+	assert.Equal(t, `{"firstReport":true}`, string(data))
+	assert.True(t, restarted.ack(seq))
+	assert.NoFileExists(t, filepath.Join(dir, "00000000000000000001.first.report"))
+}
+
+func TestReportSpoolEviction(t *testing.T) {
+	spool, err := newReportSpool(t.TempDir(), 10, 0)
+	assert.NoError(t, err)
+	spool.push(1, []byte("12345"), false)
+	spool.push(2, []byte("67890"), false)
+	spool.push(3, []byte("abcde"), false)
+	assert.Equal(t, 2, spool.len())
+	_, data, _ := spool.next()
+	assert.Equal(t, "67890", string(data))
+
+	spool, err = newReportSpool("", 0, time.Millisecond)
+	assert.NoError(t, err)
+	spool.push(1, []byte("old"), false)
+	time.Sleep(5 * time.Millisecond)
+	_, _, ok := spool.next()
+	assert.False(t, ok)
+}
+
+func TestReportSpoolEvictionRequestsFirstReport(t *testing.T) {
+	spool, err := newReportSpool("", 45, 0)
+	assert.NoError(t, err)
+	requests := 0
+	// the handler is called without the spool's mutex held
+	spool.setEvictHandler(func() {
+		requests++
+		spool.len()
+	})
+
+	spool.push(1, []byte(`{"firstReport":true}`), true)
+	spool.push(2, []byte(`{"firstReport":false}`), false)
+	assert.Equal(t, 0, requests)
+	// the first report was evicted, the deltas that follow it miss its objects
+	spool.push(3, []byte(`{"firstReport":false}`), false)
+	assert.Equal(t, 1, requests)
+	// the first report was requested already
+	spool.push(4, []byte(`{"firstReport":false}`), false)
+	assert.Equal(t, 1, requests)
+
+	// the new first report replaces the evicted deltas
+	spool.push(5, []byte(`{"firstReport":true}`), true)
+	spool.push(6, []byte(`{"firstReport":false}`), false)
+	assert.Equal(t, 1, requests)
+	spool.push(7, []byte(`{"firstReport":false,"node":{}}`), false)
+	assert.Equal(t, 2, requests)
+}
+
+func TestReportSpoolFlush(t *testing.T) {
+	spool, err := newReportSpool("", 0, 0)
+	assert.NoError(t, err)
+	spool.push(1, []byte("first"), false)
+	spool.next()
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		spool.ack(1)
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, spool.flush(ctx))
+
+	// the grace period ends before the report is acknowledged
+	spool.push(2, []byte("second"), false)
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, spool.flush(ctx), context.DeadlineExceeded)
+}
@@ -0,0 +1,368 @@
+package watch
+
+import (
+	"fmt"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	logger "github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+	"golang.org/x/net/context"
+	core "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+const defaultStorageClassAnnotation = "storageclass.kubernetes.io/is-default-class"
+
+// encryptionKeyParameters are the storage class parameters of the provisioners that encrypt the volumes with a
+// customer key, e.g. AWS kmsKeyId, GCE disk-encryption-kms-key and Azure diskEncryptionSetID
+var encryptionKeyParameters = []string{"kmskeyid", "disk-encryption-kms-key", "diskencryptionsetid", "encryptionkmskeyid"}
+
+// persistentVolumeData is a persistent volume of the report, with whether it is a host path, and is encrypted
+// according to its storage class
+type persistentVolumeData struct {
+	*core.PersistentVolume `json:",inline"`
+	IsHostPath             bool   `json:"isHostPath"`
+	ReclaimPolicy          string `json:"reclaimPolicy,omitempty"`
+	Encrypted              bool   `json:"encrypted"`
+}
+
+// storageClassData is a storage class of the report
+type storageClassData struct {
+	*storagev1.StorageClass `json:",inline"`
+	IsDefault               bool   `json:"isDefault"`
+	ReclaimPolicy           string `json:"reclaimPolicy,omitempty"`
+	Encrypted               bool   `json:"encrypted"`
+}
+
+// claimRef is a persistent volume claim a workload mounts
+type claimRef struct {
+	Name         string `json:"name"`
+	ReadOnly     bool   `json:"readOnly,omitempty"`
+	VolumeName   string `json:"volumeName,omitempty"`
+	StorageClass string `json:"storageClass,omitempty"`
+}
+
+// storageClassEncrypted reports whether the provisioner encrypts the volumes according to the storage class
+// parameters. An encrypted parameter decides, otherwise an encryption key means the volumes are encrypted
+func storageClassEncrypted(parameters map[string]string) bool {
+	lowered := make(map[string]string, len(parameters))
+	for key, value := range parameters {
+		lowered[strings.ToLower(key)] = value
+	}
+	if value, ok := lowered["encrypted"]; ok {
+		encrypted, _ := strconv.ParseBool(value)
+		return encrypted
+	}
+	for _, keyParameter := range encryptionKeyParameters {
+		if lowered[keyParameter] != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func newStorageClassData(storageClass *storagev1.StorageClass) storageClassData {
+	data := storageClassData{
+		StorageClass: storageClass,
+		IsDefault:    storageClass.Annotations[defaultStorageClassAnnotation] == "true",
+		Encrypted:    storageClassEncrypted(storageClass.Parameters),
+	}
+	if storageClass.ReclaimPolicy != nil {
+		data.ReclaimPolicy = string(*storageClass.ReclaimPolicy)
+	}
+	return data
+}
+
+// newPersistentVolumeData derives the fields of a persistent volume, the storage class is nil when it is not known
+func newPersistentVolumeData(volume *core.PersistentVolume, storageClass *storagev1.StorageClass) persistentVolumeData {
+	data := persistentVolumeData{
+		PersistentVolume: volume,
+		IsHostPath:       volume.Spec.HostPath != nil,
+		ReclaimPolicy:    string(volume.Spec.PersistentVolumeReclaimPolicy),
+	}
+	if storageClass != nil {
+		data.Encrypted = storageClassEncrypted(storageClass.Parameters)
+	}
+	return data
+}
+
+// storageClass returns the storage class from the storage classes watcher's cache, nil when it is not known
+func (wh *WatchHandler) storageClass(name string) *storagev1.StorageClass {
+	if name == "" || wh.informerFactory == nil || !wh.IsWatcherEnabled("storageclasses") {
+		return nil
+	}
+	storageClass, err := wh.informerFactory.Storage().V1().StorageClasses().Lister().Get(name)
+	if err != nil {
+		return nil
+	}
+	return storageClass
+}
+
+// persistentVolumeClaims returns the claims the workload mounts through its pod spec volumes, with the volumes they are
+// bound to from the persistent volume claims watcher's cache
+func (wh *WatchHandler) persistentVolumeClaims(microService *MicroServiceData) []claimRef {
+	if microService.Pod == nil {
+		return nil
+	}
+	claims := []claimRef{}
+	for _, volume := range microService.Pod.Spec.Volumes {
+		var claim claimRef
+		switch {
+		case volume.PersistentVolumeClaim != nil:
+			claim = claimRef{Name: volume.PersistentVolumeClaim.ClaimName, ReadOnly: volume.PersistentVolumeClaim.ReadOnly}
+		case volume.Ephemeral != nil && microService.Pod.Name != "":
+			// the claim of a generic ephemeral volume is named after the pod and the volume
+			claim = claimRef{Name: microService.Pod.Name + "-" + volume.Name}
+		default:
+			continue
+		}
+		if wh.informerFactory != nil && wh.IsWatcherEnabled("persistentvolumeclaims") {
+			if pvc, err := wh.informerFactory.Core().V1().PersistentVolumeClaims().Lister().PersistentVolumeClaims(microService.Namespace).Get(claim.Name); err == nil {
+				claim.VolumeName = pvc.Spec.VolumeName
+				if pvc.Spec.StorageClassName != nil {
+					claim.StorageClass = *pvc.Spec.StorageClassName
+				}
+			}
+		}
+		claims = append(claims, claim)
+	}
+	if len(claims) == 0 {
+		return nil
+	}
+	return claims
+}
+
+// PersistentVolumeWatch watch over persistent volumes
+func (wh *WatchHandler) PersistentVolumeWatch(ctx context.Context) {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.L().Ctx(ctx).Error("RECOVER PersistentVolumeWatch", helpers.Interface("error", err), helpers.String("stack", string(debug.Stack())))
+		}
+	}()
+	logger.L().Info("Watching over persistent volumes starting")
+	wh.waitForStorageClasses(ctx)
+	newStateChan, unregister := wh.registerNewStateChan()
+	defer unregister()
+	volumes := wh.watchInformer(ctx, "persistentvolumes", wh.informerFactory.Core().V1().PersistentVolumes().Informer())
+	for {
+		wh.handlePersistentVolumeWatch(ctx, volumes, newStateChan)
+		if ctx.Err() != nil {
+			return
+		}
+		// report every existing object again in the new first report
+		volumes.replay()
+	}
+}
+
+// waitForStorageClasses waits until the storage classes are known, so the persistent volumes are not reported as
+// unencrypted because their storage class was not listed yet
+func (wh *WatchHandler) waitForStorageClasses(ctx context.Context) {
+	if !wh.IsWatcherEnabled("storageclasses") {
+		return
+	}
+	// the storage classes watcher reports the informer's objects once it starts
+	storageClasses := wh.startInformer(ctx, "storageclasses", wh.informerFactory.Storage().V1().StorageClasses().Informer(), false)
+	if !cache.WaitForCacheSync(ctx.Done(), storageClasses.informer.HasSynced) {
+		logger.L().Ctx(ctx).Warning("storage classes were not listed before the persistent volumes watch started", helpers.Error(ctx.Err()))
+	}
+}
+
+func (wh *WatchHandler) handlePersistentVolumeWatch(ctx context.Context, events *informerEvents, newStateChan <-chan bool) {
+	logger.L().Info("Watching over persistent volumes started")
+	// encrypted is whether every reported persistent volume was reported as encrypted
+	encrypted := map[string]bool{}
+	for {
+		var event watch.Event
+		select {
+		case event = <-events.next():
+		case <-newStateChan:
+			return
+		case <-wh.storageClassChanges.changes():
+			wh.updateStorageClassVolumes(encrypted, wh.storageClassChanges.take())
+			continue
+		case <-events.done(ctx):
+			if events.stop() {
+				continue
+			}
+			return
+		}
+		volume, ok := event.Object.(*core.PersistentVolume)
+		if !ok {
+			logger.L().Ctx(ctx).Error("failed to handle persistent volume event", helpers.Error(fmt.Errorf("got unexpected persistent volume from chan")))
+			continue
+		}
+		volume.ManagedFields = []metav1.ManagedFieldsEntry{}
+		data := newPersistentVolumeData(volume, wh.storageClass(volume.Spec.StorageClassName))
+		if event.Type == watch.Deleted {
+			delete(encrypted, volume.Name)
+		} else {
+			encrypted[volume.Name] = data.Encrypted
+		}
+		switch event.Type {
+		case watch.Added:
+			informNewDataArrive(wh)
+			wh.jsonReport.AddToJsonFormat(data, PERSISTENTVOLUMES, CREATED)
+		case watch.Modified:
+			informNewDataArrive(wh)
+			wh.jsonReport.AddToJsonFormat(data, PERSISTENTVOLUMES, UPDATED)
+		case watch.Deleted:
+			informNewDataArrive(wh)
+			wh.jsonReport.AddToJsonFormat(data, PERSISTENTVOLUMES, DELETED)
+		}
+	}
+}
+
+// PersistentVolumeClaimWatch watch over persistent volume claims
+func (wh *WatchHandler) PersistentVolumeClaimWatch(ctx context.Context) {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.L().Ctx(ctx).Error("RECOVER PersistentVolumeClaimWatch", helpers.Interface("error", err), helpers.String("stack", string(debug.Stack())))
+		}
+	}()
+	newStateChan, unregister := wh.registerNewStateChan()
+	defer unregister()
+	logger.L().Info("Watching over persistent volume claims starting")
+	claims := wh.watchInformer(ctx, "persistentvolumeclaims", wh.informerFactory.Core().V1().PersistentVolumeClaims().Informer())
+	for {
+		wh.handlePersistentVolumeClaimWatch(ctx, claims, newStateChan)
+		if ctx.Err() != nil {
+			return
+		}
+		// report every existing object again in the new first report
+		claims.replay()
+	}
+}
+
+func (wh *WatchHandler) handlePersistentVolumeClaimWatch(ctx context.Context, events *informerEvents, newStateChan <-chan bool) {
+	logger.L().Info("Watching over persistent volume claims started")
+	for {
+		var event watch.Event
+		select {
+		case event = <-events.next():
+		case <-newStateChan:
+			return
+		case <-events.done(ctx):
+			if events.stop() {
+				continue
+			}
+			return
+		}
+		claim, ok := event.Object.(*core.PersistentVolumeClaim)
+		if !ok {
+			logger.L().Ctx(ctx).Error("failed to handle persistent volume claim event", helpers.Error(fmt.Errorf("got unexpected persistent volume claim from chan")))
+			continue
+		}
+		if !wh.isNamespaceWatched(claim.Namespace) {
+			continue
+		}
+		claim.ManagedFields = []metav1.ManagedFieldsEntry{}
+		switch event.Type {
+		case watch.Added:
+			informNewDataArrive(wh)
+			wh.jsonReport.AddToJsonFormat(claim, PERSISTENTVOLUMECLAIMS, CREATED)
+		case watch.Modified:
+			informNewDataArrive(wh)
+			wh.jsonReport.AddToJsonFormat(claim, PERSISTENTVOLUMECLAIMS, UPDATED)
+		case watch.Deleted:
+			informNewDataArrive(wh)
+			wh.jsonReport.AddToJsonFormat(claim, PERSISTENTVOLUMECLAIMS, DELETED)
+		}
+		wh.workloadsChanged(claim.Namespace)
+	}
+}
+
+// StorageClassWatch watch over storage classes
+func (wh *WatchHandler) StorageClassWatch(ctx context.Context) {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.L().Ctx(ctx).Error("RECOVER StorageClassWatch", helpers.Interface("error", err), helpers.String("stack", string(debug.Stack())))
+		}
+	}()
+	newStateChan, unregister := wh.registerNewStateChan()
+	defer unregister()
+	logger.L().Info("Watching over storage classes starting")
+	storageClasses := wh.watchInformer(ctx, "storageclasses", wh.informerFactory.Storage().V1().StorageClasses().Informer())
+	for {
+		wh.handleStorageClassWatch(ctx, storageClasses, newStateChan)
+		if ctx.Err() != nil {
+			return
+		}
+		// report every existing object again in the new first report
+		storageClasses.replay()
+	}
+}
+
+func (wh *WatchHandler) handleStorageClassWatch(ctx context.Context, events *informerEvents, newStateChan <-chan bool) {
+	logger.L().Info("Watching over storage classes started")
+	for {
+		var event watch.Event
+		select {
+		case event = <-events.next():
+		case <-newStateChan:
+			return
+		case <-events.done(ctx):
+			if events.stop() {
+				continue
+			}
+			return
+		}
+		storageClass, ok := event.Object.(*storagev1.StorageClass)
+		if !ok {
+			logger.L().Ctx(ctx).Error("failed to handle storage class event", helpers.Error(fmt.Errorf("got unexpected storage class from chan")))
+			continue
+		}
+		storageClass.ManagedFields = []metav1.ManagedFieldsEntry{}
+		data := newStorageClassData(storageClass)
+		switch event.Type {
+		case watch.Added:
+			informNewDataArrive(wh)
+			wh.jsonReport.AddToJsonFormat(data, STORAGECLASSES, CREATED)
+		case watch.Modified:
+			informNewDataArrive(wh)
+			wh.jsonReport.AddToJsonFormat(data, STORAGECLASSES, UPDATED)
+		case watch.Deleted:
+			informNewDataArrive(wh)
+			wh.jsonReport.AddToJsonFormat(data, STORAGECLASSES, DELETED)
+		}
+		// the parameters of a storage class are immutable, the encryption of its volumes only changes when the
+		// storage class is created or deleted
+		if event.Type != watch.Modified {
+			wh.storageClassChanges.add(storageClass.Name)
+		}
+	}
+}
+
+// updateStorageClassVolumes reports the persistent volumes of the storage classes again when their encryption changed.
+// It must be called from the persistent volumes watcher's goroutine, encrypted is the encryption it reported
+func (wh *WatchHandler) updateStorageClassVolumes(encrypted map[string]bool, storageClasses []string) {
+	changedClasses := map[string]bool{}
+	for _, name := range storageClasses {
+		changedClasses[name] = true
+	}
+	volumes, _ := wh.informerFactory.Core().V1().PersistentVolumes().Lister().List(labels.Everything())
+	changed := false
+	for _, volume := range volumes {
+		reported, ok := encrypted[volume.Name]
+		if !ok || !changedClasses[volume.Spec.StorageClassName] {
+			continue
+		}
+		volume = volume.DeepCopy()
+		volume.ManagedFields = []metav1.ManagedFieldsEntry{}
+		data := newPersistentVolumeData(volume, wh.storageClass(volume.Spec.StorageClassName))
+		if data.Encrypted == reported {
+			continue
+		}
+		encrypted[volume.Name] = data.Encrypted
+		wh.jsonReport.AddToJsonFormat(data, PERSISTENTVOLUMES, UPDATED)
+		changed = true
+	}
+	if changed {
+		informNewDataArrive(wh)
+	}
+}
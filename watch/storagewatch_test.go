@@ -0,0 +1,110 @@
+package watch
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	core "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestStorageClassEncrypted(t *testing.T) {
+	assert.True(t, storageClassEncrypted(map[string]string{"type": "gp3", "encrypted": "true"}))
+	assert.False(t, storageClassEncrypted(map[string]string{"encrypted": "false", "kmsKeyId": "arn:aws:kms:key"}))
+	assert.True(t, storageClassEncrypted(map[string]string{"disk-encryption-kms-key": "projects/p/keys/k"}))
+	assert.False(t, storageClassEncrypted(map[string]string{"type": "pd-ssd"}))
+	assert.True(t, storageClassEncrypted(map[string]string{"Encrypted": "true"}))
+}
+
+func TestNewPersistentVolumeData(t *testing.T) {
+	retain := core.PersistentVolumeReclaimRetain
+	volume := &core.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "data"},
+		Spec: core.PersistentVolumeSpec{
+			PersistentVolumeReclaimPolicy: retain,
+			StorageClassName:              "encrypted",
+			PersistentVolumeSource:        core.PersistentVolumeSource{HostPath: &core.HostPathVolumeSource{Path: "/var/data"}},
+		},
+	}
+	data := newPersistentVolumeData(volume, &storagev1.StorageClass{Parameters: map[string]string{"encrypted": "true"}})
+	assert.True(t, data.IsHostPath)
+	assert.Equal(t, "Retain", data.ReclaimPolicy)
+	assert.True(t, data.Encrypted)
+	assert.False(t, newPersistentVolumeData(volume, nil).Encrypted)
+}
+
+func TestPersistentVolumeClaims(t *testing.T) {
+	className := "standard"
+	client := fake.NewSimpleClientset(&core.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "data"},
+		Spec:       core.PersistentVolumeClaimSpec{VolumeName: "pv-1", StorageClassName: &className},
+	})
+	wh := &WatchHandler{informerFactory: newInformerFactory(client)}
+	startInformers(t, wh.informerFactory, wh.informerFactory.Core().V1().PersistentVolumeClaims().Informer())
+
+	pod := &core.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "db-0"}, Spec: core.PodSpec{Volumes: []core.Volume{
+		{Name: "data", VolumeSource: core.VolumeSource{PersistentVolumeClaim: &core.PersistentVolumeClaimVolumeSource{ClaimName: "data", ReadOnly: true}}},
+		{Name: "scratch", VolumeSource: core.VolumeSource{Ephemeral: &core.EphemeralVolumeSource{}}},
+		{Name: "config", VolumeSource: core.VolumeSource{ConfigMap: &core.ConfigMapVolumeSource{}}},
+	}}}
+	assert.Equal(t, []claimRef{
+		{Name: "data", ReadOnly: true, VolumeName: "pv-1", StorageClass: "standard"},
+		{Name: "db-0-scratch"},
+	}, wh.persistentVolumeClaims(&MicroServiceData{Pod: pod}))
+}
+
+func TestWaitForStorageClasses(t *testing.T) {
+	client := fake.NewSimpleClientset(&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "encrypted"}, Parameters: map[string]string{"encrypted": "true"}})
+	wh := &WatchHandler{informerFactory: newInformerFactory(client), informers: map[string]*informerEvents{}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	wh.waitForStorageClasses(ctx)
+	volume := &core.PersistentVolume{Spec: core.PersistentVolumeSpec{StorageClassName: "encrypted"}}
+	assert.True(t, newPersistentVolumeData(volume, wh.storageClass(volume.Spec.StorageClassName)).Encrypted)
+
+	// the storage classes watcher reports the objects of the informer the wait started
+	storageClasses := wh.startInformer(ctx, "storageclasses", wh.informerFactory.Storage().V1().StorageClasses().Informer(), true)
+	assert.Equal(t, watch.Added, nextEvent(t, storageClasses.next()).Type)
+}
+
+func TestStorageClassVolumesAreUpdated(t *testing.T) {
+	client := fake.NewSimpleClientset(&core.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Name: "data"}, Spec: core.PersistentVolumeSpec{StorageClassName: "encrypted"}})
+	wh := &WatchHandler{
+		informerFactory:         newInformerFactory(client),
+		informNewDataChannel:    make(chan int, 1),
+		clusterAPIServerVersion: &version.Info{},
+		storageClassChanges:     newNamespaceSet(),
+	}
+	startInformers(t, wh.informerFactory, wh.informerFactory.Core().V1().PersistentVolumes().Informer(), wh.informerFactory.Storage().V1().StorageClasses().Informer())
+
+	// the parameters of a storage class are immutable, only its creation and deletion change its volumes
+	storageClass := &storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "encrypted"}, Parameters: map[string]string{"encrypted": "true"}}
+	events := newInformerEvents("storageclasses", nil, nil)
+	newStateChan := make(chan bool)
+	done := make(chan struct{})
+	go func() {
+		wh.handleStorageClassWatch(context.Background(), events, newStateChan)
+		close(done)
+	}()
+	events.events <- watch.Event{Type: watch.Modified, Object: &storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "fast"}}}
+	events.events <- watch.Event{Type: watch.Added, Object: storageClass.DeepCopy()}
+	newStateChan <- true
+	<-done
+	assert.Equal(t, []string{"encrypted"}, wh.storageClassChanges.take())
+
+	// the volume reported before the storage class was known is reported encrypted, once
+	assert.NoError(t, wh.informerFactory.Storage().V1().StorageClasses().Informer().GetStore().Add(storageClass))
+	encrypted := map[string]bool{"data": false}
+	wh.updateStorageClassVolumes(encrypted, []string{"encrypted"})
+	wh.updateStorageClassVolumes(encrypted, []string{"encrypted"})
+	assert.Equal(t, map[string]bool{"data": true}, encrypted)
+	if assert.Len(t, wh.jsonReport.PersistentVolumes.Updated, 1) {
+		assert.True(t, wh.jsonReport.PersistentVolumes.Updated[0].(persistentVolumeData).Encrypted)
+	}
+}
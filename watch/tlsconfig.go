@@ -0,0 +1,91 @@
+package watch
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	logger "github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+)
+
+const (
+	TLSCABundleEnv      = "TLS_CA_BUNDLE"
+	TLSClientCertEnv    = "TLS_CLIENT_CERT"
+	TLSClientKeyEnv     = "TLS_CLIENT_KEY"
+	TLSServerNameEnv    = "TLS_SERVER_NAME"
+	HandshakeTimeoutEnv = "HANDSHAKE_TIMEOUT"
+)
+
+// loadTLSConfig creates the TLS configuration of the connections to the backend from the TLS_* environment variables.
+// The client certificate is read again on every handshake, so a rotated certificate is picked up without a restart
+func loadTLSConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if caBundle := os.Getenv(TLSCABundleEnv); caBundle != "" {
+		pem, err := os.ReadFile(caBundle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		rootCAs, err := x509.SystemCertPool()
+		if err != nil || rootCAs == nil {
+			rootCAs = x509.NewCertPool()
+		}
+		if !rootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", caBundle)
+		}
+		tlsConfig.RootCAs = rootCAs
+		logger.L().Info("using custom CA bundle", helpers.String("path", caBundle))
+	}
+
+	certFile, keyFile := os.Getenv(TLSClientCertEnv), os.Getenv(TLSClientKeyEnv)
+	if (certFile == "") != (keyFile == "") {
+		return nil, fmt.Errorf("%s and %s must be set together", TLSClientCertEnv, TLSClientKeyEnv)
+	}
+	if certFile != "" {
+		// fail early on a bad certificate instead of on the first handshake
+		if _, err := tls.LoadX509KeyPair(certFile, keyFile); err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load client certificate: %w", err)
+			}
+			return &cert, nil
+		}
+		logger.L().Info("using client certificate", helpers.String("path", certFile))
+	}
+	return tlsConfig, nil
+}
+
+// eventReceiverTLSConfig returns the TLS configuration of the connections to the event receiver, which verify its
+// certificate against TLS_SERVER_NAME when it is set. The other hosts are verified against their own name
+func eventReceiverTLSConfig(tlsConfig *tls.Config) *tls.Config {
+	serverName := os.Getenv(TLSServerNameEnv)
+	if serverName == "" || tlsConfig == nil {
+		return tlsConfig
+	}
+	tlsConfig = tlsConfig.Clone()
+	tlsConfig.ServerName = serverName
+	return tlsConfig
+}
+
+// handshakeTimeout is the time a connection to the backend has to complete its TLS (and websocket) handshake
+func handshakeTimeout() time.Duration {
+	return time.Duration(getNumericValueFromEnvVar(HandshakeTimeoutEnv, 45)) * time.Second
+}
+
+// newHTTPClient creates an HTTP client that uses tlsConfig and the HTTPS_PROXY / NO_PROXY environment variables
+func newHTTPClient(tlsConfig *tls.Config, timeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+	transport.TLSClientConfig = tlsConfig
+	transport.TLSHandshakeTimeout = handshakeTimeout()
+	return &http.Client{Transport: transport, Timeout: timeout}
+}
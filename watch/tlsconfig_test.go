@@ -0,0 +1,80 @@
+package watch
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writePEM(t *testing.T, path, blockType string, bytes []byte) {
+	assert.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: bytes}), 0o600))
+}
+
+func TestLoadTLSConfigCABundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	// the server certificate is not trusted without the CA bundle
+	tlsConfig, err := loadTLSConfig()
+	assert.NoError(t, err)
+	_, err = newHTTPClient(tlsConfig, time.Second).Get(server.URL)
+	assert.Error(t, err)
+
+	caBundle := filepath.Join(t.TempDir(), "ca.pem")
+	writePEM(t, caBundle, "CERTIFICATE", server.Certificate().Raw)
+	t.Setenv(TLSCABundleEnv, caBundle)
+	t.Setenv(TLSServerNameEnv, "example.com")
+	tlsConfig, err = loadTLSConfig()
+	assert.NoError(t, err)
+	resp, err := newHTTPClient(tlsConfig, time.Second).Get(server.URL)
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	// the server name only applies to the event receiver, the shared configuration verifies every host by its own name
+	assert.Empty(t, tlsConfig.ServerName)
+	assert.Equal(t, "example.com", eventReceiverTLSConfig(tlsConfig).ServerName)
+	assert.Empty(t, tlsConfig.ServerName)
+}
+
+func TestLoadTLSConfigClientCertificate(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "kollector"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writePEM(t, certFile, "CERTIFICATE", cert)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyBytes)
+
+	t.Setenv(TLSClientCertEnv, certFile)
+	_, err = loadTLSConfig()
+	assert.Error(t, err, "a certificate without a key")
+
+	t.Setenv(TLSClientKeyEnv, keyFile)
+	tlsConfig, err := loadTLSConfig()
+	assert.NoError(t, err)
+	clientCert, err := tlsConfig.GetClientCertificate(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, cert, clientCert.Certificate[0])
+}
@@ -4,16 +4,21 @@ import (
 	"container/list"
 	"flag"
 	"fmt"
-	"os"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/armosec/utils-k8s-go/armometadata"
 	"github.com/kubescape/k8s-interface/k8sinterface"
-	"github.com/kubescape/kollector/consts"
 	restclient "k8s.io/client-go/rest"
 
 	apixv1beta1client "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/typed/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 )
 
@@ -72,6 +77,11 @@ func (rm *resourceMap) updateFront(index int, obj interface{}) {
 		rm.resourceMap[index] = mapElem
 	}
 }
+func (rm *resourceMap) reportedVersions(object func(interface{}) metav1.Object) map[string]string {
+	rm.mutex.RLock()
+	defer rm.mutex.RUnlock()
+	return reportedVersions(rm.resourceMap, object)
+}
 func (rm *resourceMap) len() int {
 	rm.mutex.RLock()
 	defer rm.mutex.RUnlock()
@@ -91,7 +101,17 @@ type WatchHandler struct {
 	extensionsClient apixv1beta1client.ApiextensionsV1beta1Interface
 	RestAPIClient    kubernetes.Interface
 	K8sApi           *k8sinterface.KubernetesApi
-	WebSocketHandle  *WebSocketHandler
+	Sink             ReportSink
+	// informerFactory shares one list and watch of every resource between the watchers
+	informerFactory informers.SharedInformerFactory
+	informers       map[string]*informerEvents
+	informersMutex  sync.Mutex
+	// statuses is the health of every watcher
+	statuses      map[string]*watcherStatus
+	statusesMutex sync.Mutex
+	// dynamicInformerFactory watches the WATCH_RESOURCES resources
+	dynamicInformerFactory dynamicinformer.DynamicSharedInformerFactory
+	dynamicResources       []schema.GroupVersionResource
 	// cluster info
 	clusterAPIServerVersion *version.Info
 	cloudVendor             string
@@ -101,19 +121,49 @@ type WatchHandler struct {
 	ndm map[int]*list.List
 	// services list
 	sdm map[int]*list.List
-	// pods list
+	// cron jobs list, owned by the cron jobs watcher
 	cjm map[int]*list.List
 	// secrets list
 	secretdm *resourceMap
 	// namespaces list
 	namespacedm *resourceMap
+	// ingresses list
+	ingressdm *resourceMap
+	// network policies list
+	networkPolicydm *resourceMap
+	// workloadChanges are the namespaces whose workloads' network isolation and bindings have to be computed again,
+	// cronJobChanges the same namespaces for the cron jobs watcher
+	workloadChanges *namespaceSet
+	cronJobChanges  *namespaceSet
+	// storageClassChanges are the names of the storage classes whose persistent volumes' encryption has to be
+	// computed again
+	storageClassChanges *namespaceSet
 
-	jsonReport             jsonFormat
+	jsonReport jsonFormat
+	// resourcesMutex guards jsonReport.Resources, the dynamic watchers write it from their own goroutines,
+	// microServicesMutex guards jsonReport.MicroServices that the pods and the cron jobs watchers write
+	resourcesMutex         sync.Mutex
+	microServicesMutex     sync.Mutex
+	reportSequence         uint64 // sequence number of the last prepared report
 	informNewDataChannel   chan int
 	aggregateFirstDataFlag bool
+	// coalesceWindow is the time the events of an object are merged, and the least time between two reports
+	coalesceWindow time.Duration
 	// newStateReportChans is calling in a loop whenever new connection to BE is initialized
 	newStateReportChans []chan bool
+	newStateReportMutex sync.Mutex
 	includeNamespaces   []string
+	excludeNamespaces   []string
+	namespacesMutex     sync.RWMutex
+	// disabledWatchers are the watchers whose resources the service account cannot list and watch
+	disabledWatchers map[string]bool
+	capabilities     *capabilities
+	// namespacesSelected is set when the namespaces informer only holds the namespaces whose objects are collected
+	namespacesSelected bool
+	// firstReportRequested is set when a sink reconnected or the backend asked for a full snapshot
+	firstReportRequested atomic.Bool
+	// reportingPaused stops sending reports while the changes keep being aggregated
+	reportingPaused atomic.Bool
 
 	config *armometadata.ClusterConfig
 
@@ -122,8 +172,6 @@ type WatchHandler struct {
 
 func CreateWatchHandler(config *armometadata.ClusterConfig) (*WatchHandler, error) {
 
-	componentNamespace := os.Getenv(consts.NamespaceEnvironmentVariable)
-
 	if err := parseArgument(); err != nil {
 		return nil, fmt.Errorf("failed to parse args: %s", err.Error())
 	}
@@ -137,33 +185,89 @@ func CreateWatchHandler(config *armometadata.ClusterConfig) (*WatchHandler, erro
 		return nil, fmt.Errorf("apiV1beta1client.NewForConfig failed: %s", err.Error())
 	}
 
-	erURL, err := setWebSocketURL(config)
+	tlsConfig, err := loadTLSConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS configuration: %s", err.Error())
+	}
+
+	dynamicResources, err := parseWatchResources()
+	if err != nil {
+		return nil, err
+	}
+	includeNamespaces, err := parseNamespacePatterns(IncludeNamespacesEnv)
+	if err != nil {
+		return nil, err
+	}
+	if len(includeNamespaces) == 0 {
+		includeNamespaces = []string{""} // every namespace
+	}
+	excludeNamespaces, err := parseNamespacePatterns(ExcludeNamespacesEnv)
+	if err != nil {
+		return nil, err
+	}
+	if err := parseListSelectors(); err != nil {
+		return nil, err
+	}
+	dynamicClient, err := dynamic.NewForConfig(k8sinterface.GetK8sConfig())
+	if err != nil {
+		return nil, fmt.Errorf("dynamic.NewForConfig failed: %s", err.Error())
+	}
+
+	sink, err := createReportSink(config, tlsConfig, createTokenSource(k8sAPiObj.KubernetesClient))
 	if err != nil {
-		return nil, fmt.Errorf("failed to set event receiver url: %s", err.Error())
+		return nil, fmt.Errorf("failed to create report sink: %s", err.Error())
 	}
 
 	result := WatchHandler{RestAPIClient: k8sAPiObj.KubernetesClient,
-		WebSocketHandle:  createWebSocketHandler(erURL),
-		extensionsClient: extensionsClientSet,
-		K8sApi:           k8sinterface.NewKubernetesApi(),
-		pdm:              make(map[int]*list.List),
-		ndm:              make(map[int]*list.List),
-		sdm:              make(map[int]*list.List),
-		cjm:              make(map[int]*list.List),
-		config:           config,
-		secretdm:         newResourceMap(),
-		namespacedm:      newResourceMap(),
+		Sink:                   sink,
+		extensionsClient:       extensionsClientSet,
+		K8sApi:                 k8sinterface.NewKubernetesApi(),
+		informerFactory:        newInformerFactory(k8sAPiObj.KubernetesClient),
+		informers:              make(map[string]*informerEvents),
+		dynamicInformerFactory: newDynamicInformerFactory(dynamicClient),
+		dynamicResources:       dynamicResources,
+		pdm:                    make(map[int]*list.List),
+		ndm:                    make(map[int]*list.List),
+		sdm:                    make(map[int]*list.List),
+		cjm:                    make(map[int]*list.List),
+		config:                 config,
+		secretdm:               newResourceMap(),
+		namespacedm:            newResourceMap(),
+		ingressdm:              newResourceMap(),
+		networkPolicydm:        newResourceMap(),
+		workloadChanges:        newNamespaceSet(),
+		cronJobChanges:         newNamespaceSet(),
+		storageClassChanges:    newNamespaceSet(),
 		jsonReport: jsonFormat{
 			FirstReport: true,
 		},
-		informNewDataChannel:   make(chan int),
+		reportSequence:         initialReportSequence(sink),
+		informNewDataChannel:   make(chan int, 1),
+		coalesceWindow:         time.Duration(getNumericValueFromEnvVar(CoalesceWindowEnv, 0)) * time.Second,
 		aggregateFirstDataFlag: true,
-		includeNamespaces:      []string{componentNamespace}, // ignore only the component namespace
-		notifyUpdates:          newInClusterNotifier(config),
+		includeNamespaces:      includeNamespaces,
+		excludeNamespaces:      excludeNamespaces,
+		namespacesSelected:     isNamespaceSelectorSet(),
+		notifyUpdates:          newInClusterNotifier(config, newHTTPClient(tlsConfig, 0)),
+	}
+	if commands, ok := sink.(commandSink); ok {
+		commands.setCommandHandler(result.handleCommand)
 	}
 	return &result, nil
 }
 
+// initialReportSequence starts the report sequence numbers at the process start time,
+// so they keep increasing across restarts and never collide with reports that are still spooled
+func initialReportSequence(sink ReportSink) uint64 {
+	seq := uint64(time.Now().UnixNano())
+	if spooled, ok := sink.(spooledSink); ok {
+		if last := spooled.lastSequence(); last > seq {
+			return last
+		}
+	}
+	return seq
+}
+
 func parseArgument() error {
 
 	threFlag := flag.Lookup("stderrthreshold")
@@ -173,21 +277,52 @@ func parseArgument() error {
 	return nil
 }
 
-// SetFirstReportFlag set first report flag
+// SetFirstReportFlag set first report flag. A new first report is only requested here, so it can be called from any
+// goroutine: the sender starts it and the watchers reset their own state
 func (wh *WatchHandler) SetFirstReportFlag(first bool) {
-	if wh.jsonReport.FirstReport == first {
+	if !first {
+		wh.jsonReport.FirstReport = false
+		return
+	}
+	wh.firstReportRequested.Store(true)
+	wh.wakeSender()
+}
+
+// startFirstReport makes the next report a first report and signals every watcher to report its objects again. It
+// is called by the sender and does not wait for the watchers
+func (wh *WatchHandler) startFirstReport() {
+	if !wh.firstReportRequested.Swap(false) || wh.jsonReport.FirstReport {
 		return
 	}
-	wh.jsonReport.FirstReport = first
-	if first {
-		wh.ndm = make(map[int]*list.List)
-		wh.pdm = make(map[int]*list.List)
-		wh.sdm = make(map[int]*list.List)
-		wh.cjm = make(map[int]*list.List)
-		wh.secretdm = newResourceMap()
-		wh.namespacedm = newResourceMap()
+	wh.jsonReport.FirstReport = true
+	// a new first report must carry the cluster info again
+	wh.aggregateFirstDataFlag = true
+	wh.newStateReportMutex.Lock()
+	defer wh.newStateReportMutex.Unlock()
+	for chanIdx := range wh.newStateReportChans {
+		// a watcher that did not take the previous signal yet reports everything once
+		select {
+		case wh.newStateReportChans[chanIdx] <- true:
+		default:
+		}
+	}
+}
+
+// registerNewStateChan returns the channel a watcher is signalled on when a new first report starts, and the function
+// the watcher unregisters it with once it returns
+func (wh *WatchHandler) registerNewStateChan() (chan bool, func()) {
+	newStateChan := make(chan bool, 1)
+	wh.newStateReportMutex.Lock()
+	defer wh.newStateReportMutex.Unlock()
+	wh.newStateReportChans = append(wh.newStateReportChans, newStateChan)
+	return newStateChan, func() {
+		wh.newStateReportMutex.Lock()
+		defer wh.newStateReportMutex.Unlock()
 		for chanIdx := range wh.newStateReportChans {
-			wh.newStateReportChans[chanIdx] <- true
+			if wh.newStateReportChans[chanIdx] == newStateChan {
+				wh.newStateReportChans = append(wh.newStateReportChans[:chanIdx], wh.newStateReportChans[chanIdx+1:]...)
+				return
+			}
 		}
 	}
 }
@@ -197,15 +332,52 @@ func (wh *WatchHandler) getFirstReportFlag() bool {
 	return wh.jsonReport.FirstReport
 }
 
+// isNamespaceWatched reports whether the objects of the namespace are collected
 func (wh *WatchHandler) isNamespaceWatched(namespace string) bool {
+	return wh.isNamespaceNameWatched(namespace) && wh.isNamespaceSelected(namespace)
+}
+
+// isNamespaceNameWatched matches the namespace against the included and excluded namespaces, an excluded namespace
+// is not watched even when it is included
+func (wh *WatchHandler) isNamespaceNameWatched(namespace string) bool {
+	wh.namespacesMutex.RLock()
+	defer wh.namespacesMutex.RUnlock()
+	for nsIdx := range wh.excludeNamespaces {
+		if namespaceMatches(wh.excludeNamespaces[nsIdx], namespace) {
+			return false
+		}
+	}
 	for nsIdx := range wh.includeNamespaces {
-		if wh.includeNamespaces[nsIdx] == "" || wh.includeNamespaces[nsIdx] == namespace {
+		if namespaceMatches(wh.includeNamespaces[nsIdx], namespace) {
 			return true
 		}
 	}
 	return false
 }
 
+// setNamespaceWatched adds the namespace to the included namespaces, or to the excluded ones when watched is false
+func (wh *WatchHandler) setNamespaceWatched(namespace string, watched bool) {
+	wh.namespacesMutex.Lock()
+	defer wh.namespacesMutex.Unlock()
+	wh.includeNamespaces = removeString(wh.includeNamespaces, namespace)
+	wh.excludeNamespaces = removeString(wh.excludeNamespaces, namespace)
+	if watched {
+		wh.includeNamespaces = append(wh.includeNamespaces, namespace)
+	} else {
+		wh.excludeNamespaces = append(wh.excludeNamespaces, namespace)
+	}
+}
+
+func removeString(list []string, s string) []string {
+	result := []string{}
+	for i := range list {
+		if list[i] != s {
+			result = append(result, list[i])
+		}
+	}
+	return result
+}
+
 // getAggregateFirstDataFlag return pointer
 func (wh *WatchHandler) getAggregateFirstDataFlag() *bool {
 	return &wh.aggregateFirstDataFlag
@@ -0,0 +1,35 @@
+package watch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFirstReportRequest(t *testing.T) {
+	wh := &WatchHandler{informNewDataChannel: make(chan int, 1)}
+	newStateChan, unregister := wh.registerNewStateChan()
+
+	// the request does not wait for the watchers, it only wakes the sender
+	wh.SetFirstReportFlag(true)
+	assert.False(t, wh.getFirstReportFlag())
+	assert.Len(t, wh.informNewDataChannel, 1)
+
+	wh.startFirstReport()
+	assert.True(t, <-newStateChan)
+	assert.True(t, wh.getFirstReportFlag())
+	assert.True(t, *wh.getAggregateFirstDataFlag())
+
+	// the request was taken, the watchers are not signalled again
+	wh.SetFirstReportFlag(false)
+	wh.startFirstReport()
+	assert.False(t, wh.getFirstReportFlag())
+	assert.Len(t, newStateChan, 0)
+
+	// a watcher that returned is not signalled, the sender does not wait for it
+	unregister()
+	assert.Empty(t, wh.newStateReportChans)
+	wh.SetFirstReportFlag(true)
+	wh.startFirstReport()
+	assert.Len(t, newStateChan, 0)
+}
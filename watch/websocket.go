@@ -2,12 +2,17 @@ package watch
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
 	"os"
 	"runtime/debug"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/armosec/utils-k8s-go/armometadata"
@@ -31,23 +36,61 @@ const (
 )
 
 const (
-	WaitBeforeReportEnv = "WAIT_BEFORE_REPORT"
+	ReconnectInitialBackoffEnv = "RECONNECT_INITIAL_BACKOFF"
+	ReconnectMaxBackoffEnv     = "RECONNECT_MAX_BACKOFF"
+	SpoolDirEnv                = "SPOOL_DIR"
+	SpoolMaxSizeEnv            = "SPOOL_MAX_SIZE"
+	SpoolMaxAgeEnv             = "SPOOL_MAX_AGE"
+	AckTimeoutEnv              = "ACK_TIMEOUT"
 )
 
 type DataSocket struct {
 	message string
 	RType   ReqType
+	// conn is the connection an EXIT message refers to, so a late EXIT of an old connection does not tear down a new one
+	conn *websocket.Conn
 }
 
 type WebSocketHandler struct {
-	data       chan DataSocket
-	u          url.URL
-	mutex      *sync.Mutex
-	SignalChan chan os.Signal
+	data    chan DataSocket
+	u       url.URL
+	mutex   *sync.Mutex
+	backoff *backoff
+	// spool holds the reports until they are written to the websocket, or acknowledged when ackTimeout is set
+	spool *reportSpool
+	// ackTimeout is the time the backend has to acknowledge a report before the connection is considered broken.
+	// Zero disables acknowledgements
+	ackTimeout time.Duration
+	// commandHandler executes the control commands the backend sends
+	commandHandler commandHandler
+	// maxMessageSize is the size above which reports are split into chunks. Zero disables chunking
+	maxMessageSize int
+	dialer         *websocket.Dialer
+	// contentEncoding compresses the reports into binary messages when it is set
+	contentEncoding string
+	// tokens authenticates the connection, nil connects unauthenticated
+	tokens tokenSource
 }
 
-func setWebSocketURL(config *armometadata.ClusterConfig) (*url.URL, error) {
-	u, err := url.Parse(config.EventReceiverWebsocketURL)
+// inboundMessage is a message the backend sends over the websocket
+type inboundMessage struct {
+	Ack     *reportAck      `json:"ack,omitempty"`
+	Command *controlCommand `json:"command,omitempty"`
+}
+
+// outboundMessage is a message kollector sends over the websocket besides the reports
+type outboundMessage struct {
+	CommandResponse *commandResponse `json:"commandResponse,omitempty"`
+}
+
+// reportAck acknowledges that the backend processed a report
+type reportAck struct {
+	ReportID       string `json:"reportID"`
+	SequenceNumber uint64 `json:"sequenceNumber"`
+}
+
+func setWebSocketURL(eventReceiverURL string, config *armometadata.ClusterConfig) (*url.URL, error) {
+	u, err := url.Parse(eventReceiverURL)
 	if err != nil {
 		return nil, err
 	}
@@ -60,114 +103,286 @@ func setWebSocketURL(config *armometadata.ClusterConfig) (*url.URL, error) {
 
 	return u, nil
 }
-func createWebSocketHandler(u *url.URL) *WebSocketHandler {
+func createWebSocketHandler(u *url.URL, spool *reportSpool, tlsConfig *tls.Config, tokens tokenSource) *WebSocketHandler {
 	logger.L().Info("connecting websocket", helpers.String("URL", u.String()))
 	wsh := WebSocketHandler{
-		u:          *u,
-		data:       make(chan DataSocket),
-		mutex:      &sync.Mutex{},
-		SignalChan: make(chan os.Signal),
+		u:     *u,
+		data:  make(chan DataSocket, 2),
+		mutex: &sync.Mutex{},
+		backoff: newBackoff(
+			time.Duration(getNumericValueFromEnvVar(ReconnectInitialBackoffEnv, 1))*time.Second,
+			time.Duration(getNumericValueFromEnvVar(ReconnectMaxBackoffEnv, 60))*time.Second),
+		spool:          spool,
+		tokens:         tokens,
+		ackTimeout:     time.Duration(getNumericValueFromEnvVar(AckTimeoutEnv, 0)) * time.Second,
+		maxMessageSize: maxMessageSize(),
+	}
+	dialer := *websocket.DefaultDialer
+	dialer.Proxy = http.ProxyFromEnvironment
+	dialer.TLSClientConfig = tlsConfig
+	dialer.HandshakeTimeout = handshakeTimeout()
+	switch compression := os.Getenv(ReportCompressionEnv); {
+	case compression == deflateCompression:
+		dialer.EnableCompression = true
+	case isContentEncodingSupported(compression):
+		wsh.contentEncoding = compression
+	case compression != "":
+		logger.L().Error("unsupported report compression, sending uncompressed reports", helpers.String("compression", compression))
 	}
+	wsh.dialer = &dialer
 	return &wsh
 }
 
-func (wsh *WebSocketHandler) connectToWebSocket(ctx context.Context, sleepBeforeConnection time.Duration) (*websocket.Conn, error) {
-
-	var err error
-	var conn *websocket.Conn
+// dial connects once to the event receiver, authenticating with the current access token
+func (wsh *WebSocketHandler) dial(ctx context.Context) (*websocket.Conn, error) {
+	header, err := authorizationHeader(ctx, wsh.tokens)
+	if err != nil {
+		return nil, err
+	}
+	conn, resp, err := wsh.dialer.DialContext(ctx, wsh.u.String(), header)
+	if err != nil {
+		if authErr := checkAuthenticationStatus(resp); authErr != nil {
+			return nil, authErr
+		}
+		return nil, err
+	}
+	return conn, nil
+}
 
-	tries := 60
-	for reconnectionCounter := 0; reconnectionCounter < tries; reconnectionCounter++ {
-		time.Sleep(time.Second * 1)
-		if conn, _, err = websocket.DefaultDialer.Dial(wsh.u.String(), nil); err == nil {
+// connectToWebSocket dials the event receiver until it succeeds, waiting a jittered exponential backoff between attempts
+func (wsh *WebSocketHandler) connectToWebSocket(ctx context.Context) (*websocket.Conn, error) {
+	for {
+		conn, err := wsh.dial(ctx)
+		if err == nil {
 			logger.L().Ctx(ctx).Info("connected successfully", helpers.String("URL", wsh.u.String()))
+			wsh.backoff.reset()
 			wsh.setPingPongHandler(ctx, conn)
 			return conn, nil
 		}
+		delay := wsh.backoff.next()
+		if errors.Is(err, errAuthenticationFailed) {
+			logger.L().Ctx(ctx).Error("event receiver rejected the access token, retrying", helpers.String("URL", wsh.u.String()), helpers.String("retryIn", delay.String()), helpers.Error(err))
+		} else {
+			logger.L().Ctx(ctx).Warning("failed to connect to websocket, retrying", helpers.String("URL", wsh.u.String()), helpers.String("retryIn", delay.String()), helpers.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("stopped connecting to websocket: %w", ctx.Err())
+		case <-time.After(delay):
+		}
 	}
-
-	return nil, fmt.Errorf("cant connect to websocket after %d tries", tries)
-
 }
 
-// SendReportRoutine function sending updates
-func (wsh *WebSocketHandler) SendReportRoutine(ctx context.Context, isServerReady *bool, reconnectCallback func(bool)) error {
+// SendReportRoutine function sending updates. When the connection breaks it reconnects in-process and calls
+// reconnectCallback(true) so the watchers send a full first report over the new connection
+func (wsh *WebSocketHandler) SendReportRoutine(ctx context.Context, isServerReady *atomic.Bool, reconnectCallback func(bool)) error {
 	defer func() {
 		if err := recover(); err != nil {
 			logger.L().Ctx(ctx).Error("RECOVER sendReportRoutine", helpers.Interface("error", err), helpers.String("stack", string(debug.Stack())))
 		}
 	}()
+	wsh.spool.setEvictHandler(func() { reconnectCallback(true) })
+	reconnected := false
 	for {
-		t := getNumericValueFromEnvVar(WaitBeforeReportEnv, 30)
-		conn, err := wsh.connectToWebSocket(ctx, time.Duration(t)*time.Second)
+		conn, err := wsh.connectToWebSocket(ctx)
 		if err != nil {
 			return err
 		}
-		*isServerReady = true
+		isServerReady.Store(true)
+		if reconnected {
+			reconnectCallback(true)
+		}
+		reconnected = true
+
+		err = wsh.handleSendReportRoutine(ctx, conn)
+		isServerReady.Store(false)
+		if ctx.Err() != nil {
+			return err
+		}
+		logger.L().Ctx(ctx).Warning("websocket connection lost, reconnecting", helpers.Error(err))
+	}
+}
 
-		wsh.handleSendReportRoutine(ctx, conn, reconnectCallback)
+// handleSendReportRoutine writes the spooled reports to conn until the connection fails.
+// Reports that were not acknowledged over a previous connection are sent again first
+func (wsh *WebSocketHandler) handleSendReportRoutine(ctx context.Context, conn *websocket.Conn) error {
+	wsh.spool.rewind()
+	var ackCheck <-chan time.Time
+	if wsh.ackTimeout > 0 {
+		ticker := time.NewTicker(wsh.ackTimeout / 2)
+		defer ticker.Stop()
+		ackCheck = ticker.C
+	}
+	for {
+		if err := wsh.drainSpool(ctx, conn); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			wsh.closeGracefully(ctx, conn)
+			return ctx.Err()
+		case <-wsh.spool.ready():
+		case <-ackCheck:
+			if sentAt, ok := wsh.spool.oldestUnacknowledged(); ok && time.Since(sentAt) > wsh.ackTimeout {
+				wsh.mutex.Lock()
+				conn.Close()
+				wsh.mutex.Unlock()
+				return fmt.Errorf("report was not acknowledged within %s", wsh.ackTimeout.String())
+			}
+		case data := <-wsh.data:
+			if data.RType != EXIT || data.conn != conn {
+				continue // exit message of a connection that was already replaced
+			}
+			logger.L().Ctx(ctx).Error("websocket received exit code exit", helpers.String("message", data.message))
+			return fmt.Errorf("connection closed: %s", data.message)
+		}
 	}
+}
 
-	// use mutex for writing message that way if write failed only the failed writing will reconnect
+// closeGracefully sends a close frame, so the backend knows the connection was not lost
+func (wsh *WebSocketHandler) closeGracefully(ctx context.Context, conn *websocket.Conn) {
+	wsh.mutex.Lock()
+	defer wsh.mutex.Unlock()
+	message := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "kollector is shutting down")
+	if err := conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second)); err != nil {
+		logger.L().Ctx(ctx).Warning("failed to send websocket close frame", helpers.Error(err))
+	}
+	conn.Close()
+	logger.L().Ctx(ctx).Info("websocket closed", helpers.String("URL", wsh.u.String()))
 }
 
-func (wsh *WebSocketHandler) handleSendReportRoutine(ctx context.Context, conn *websocket.Conn, reconnectCallback func(bool)) error {
+func (wsh *WebSocketHandler) drainSpool(ctx context.Context, conn *websocket.Conn) error {
 	for {
-		data := <-wsh.data
-		wsh.mutex.Lock()
+		seq, message, ok := wsh.spool.next()
+		if !ok {
+			return nil
+		}
+		timeID := time.Now().UnixNano()
+		if err := wsh.writeReport(ctx, conn, message); err != nil {
+			return err
+		}
+		if wsh.ackTimeout == 0 {
+			wsh.spool.ack(seq)
+		}
+		logger.L().Ctx(ctx).Debug("message sent", helpers.Int("time", int(timeID)), helpers.Int("sequenceNumber", int(seq)))
+	}
+}
 
-		switch data.RType {
-		case MESSAGE:
-			timeID := time.Now().UnixNano()
-			err := conn.WriteMessage(websocket.TextMessage, []byte(data.message))
-			if err != nil {
-				// count on K8s pod lifecycle logic to restart the process again and then reconnect
-				os.Exit(4)
+// writeReport writes a report to conn, compressed when contentEncoding is set
+// and split into chunks when it is larger than maxMessageSize
+func (wsh *WebSocketHandler) writeReport(ctx context.Context, conn *websocket.Conn, report []byte) error {
+	messageType := websocket.TextMessage
+	var messages [][]byte
+	var err error
+	if wsh.contentEncoding != "" {
+		if messages, err = encodeReport(report, wsh.contentEncoding, wsh.maxMessageSize); err == nil {
+			messageType = websocket.BinaryMessage
+		} else {
+			logger.L().Ctx(ctx).Error("failed to compress report, sending it uncompressed", helpers.Error(err))
+		}
+	}
+	if messageType == websocket.TextMessage {
+		if messages, err = splitReport(report, wsh.maxMessageSize); err != nil {
+			logger.L().Ctx(ctx).Error("failed to split report into chunks, sending it whole", helpers.Error(err))
+			messages = [][]byte{report}
+		}
+	}
+	wsh.mutex.Lock()
+	defer wsh.mutex.Unlock()
+	for i := range messages {
+		if err := conn.WriteMessage(messageType, messages[i]); err != nil {
+			conn.Close()
+			return fmt.Errorf("failed to write message: %w", err)
+		}
+	}
+	return nil
+}
 
-			} else {
-				logger.L().Ctx(ctx).Debug("message sent", helpers.Int("time", int(timeID)))
-			}
-		case EXIT:
-			logger.L().Ctx(ctx).Error("websocket received exit code exit", helpers.String("message", data.message))
-			// count on K8s pod lifecycle logic to restart the process again and then reconnect
-			os.Exit(4)
+// handleInboundMessage processes a message the backend sent over the websocket
+func (wsh *WebSocketHandler) handleInboundMessage(ctx context.Context, conn *websocket.Conn, message []byte) {
+	inbound := inboundMessage{}
+	if err := json.Unmarshal(message, &inbound); err != nil {
+		logger.L().Ctx(ctx).Debug("ignoring unknown websocket message", helpers.Error(err))
+		return
+	}
+	if inbound.Ack != nil {
+		if wsh.spool.ack(inbound.Ack.SequenceNumber) {
+			logger.L().Ctx(ctx).Debug("report acknowledged", helpers.String("reportID", inbound.Ack.ReportID), helpers.Int("sequenceNumber", int(inbound.Ack.SequenceNumber)))
+		}
+	}
+	if inbound.Command != nil {
+		err := fmt.Errorf("commands are not supported")
+		if wsh.commandHandler != nil {
+			err = wsh.commandHandler(ctx, inbound.Command)
+		}
+		if err != nil {
+			logger.L().Ctx(ctx).Error("failed to execute command", helpers.String("id", inbound.Command.ID), helpers.String("name", inbound.Command.Name), helpers.Error(err))
 		}
-		wsh.mutex.Unlock()
+		wsh.writeOutboundMessage(ctx, conn, &outboundMessage{CommandResponse: newCommandResponse(inbound.Command, err)})
 	}
 }
 
-func (wh *WatchHandler) SendMessageToWebSocket(jsonData []byte) {
-	data := DataSocket{message: string(jsonData), RType: MESSAGE}
+func (wsh *WebSocketHandler) writeOutboundMessage(ctx context.Context, conn *websocket.Conn, message *outboundMessage) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		logger.L().Ctx(ctx).Error("failed to marshal websocket message", helpers.Error(err))
+		return
+	}
+	wsh.mutex.Lock()
+	defer wsh.mutex.Unlock()
+	if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		logger.L().Ctx(ctx).Error("failed to write websocket message", helpers.Error(err))
+	}
+}
 
-	wh.WebSocketHandle.data <- data
+func (wsh *WebSocketHandler) setCommandHandler(handler commandHandler) {
+	wsh.commandHandler = handler
 }
 
-// ListenerAndSender listen for changes in cluster and send reports to websocket
+// ListenerAndSender listen for changes in cluster and send reports to the report sink
 func (wh *WatchHandler) ListenerAndSender(ctx context.Context) {
 	defer func() {
 		if err := recover(); err != nil {
 			logger.L().Ctx(ctx).Error("RECOVER ListenerAndSender", helpers.Interface("error", err), helpers.String("stack", string(debug.Stack())))
 		}
 	}()
-	wh.SetFirstReportFlag(true)
 	for {
+		wh.startFirstReport()
+		if wh.reportingPaused.Load() {
+			if !WaitTillNewDataArrived(ctx, wh) {
+				return
+			}
+			continue
+		}
 		jsonData := prepareDataToSend(ctx, wh)
 		if jsonData == nil || isEmptyFirstReport(jsonData) {
 			continue // skip (ususally first) report in case it is empty
 		}
 		if jsonData != nil {
-			logger.L().Ctx(ctx).Debug("sending report to websocket", helpers.String("report", string(jsonData)))
-			wh.SendMessageToWebSocket(jsonData)
+			logger.L().Ctx(ctx).Debug("sending report", helpers.String("report", string(jsonData)))
+			wh.Sink.Send(wh.reportSequence, jsonData, wh.getFirstReportFlag())
 		}
 		if wh.getFirstReportFlag() {
 			wh.SetFirstReportFlag(false)
 		}
-		if WaitTillNewDataArrived(wh) {
-			continue
+		if !wh.waitReportInterval(ctx) || !WaitTillNewDataArrived(ctx, wh) {
+			return
 		}
 	}
 }
 
+// SendPendingReport sends the changes the watchers aggregated before they stopped, it is called once the watchers
+// and ListenerAndSender returned
+func (wh *WatchHandler) SendPendingReport(ctx context.Context) {
+	if wh.reportingPaused.Load() || wh.pendingObjects() == 0 {
+		return
+	}
+	if jsonData := prepareDataToSend(ctx, wh); jsonData != nil && !isEmptyFirstReport(jsonData) {
+		logger.L().Ctx(ctx).Info("sending the last report before shutting down", helpers.Int("sequenceNumber", int(wh.reportSequence)))
+		wh.Sink.Send(wh.reportSequence, jsonData, wh.getFirstReportFlag())
+	}
+}
+
 func (wsh *WebSocketHandler) setPingPongHandler(ctx context.Context, conn *websocket.Conn) {
 	end := false
 	timeout := 10 * time.Second
@@ -212,7 +427,8 @@ func (wsh *WebSocketHandler) setPingPongHandler(ctx context.Context, conn *webso
 			if end {
 				break
 			}
-			if _, _, err := conn.ReadMessage(); err != nil {
+			_, message, err := conn.ReadMessage()
+			if err != nil {
 				if end {
 					break
 				}
@@ -221,16 +437,22 @@ func (wsh *WebSocketHandler) setPingPongHandler(ctx context.Context, conn *webso
 				wsh.closeConnection(conn, "read message error")
 				break
 			}
-			time.Sleep(timeout)
+			wsh.handleInboundMessage(ctx, conn, message)
 		}
 	}()
 }
 
+// closeConnection closes conn and tells the send loop about it. The send never blocks, the send loop of conn may
+// have returned already, and then nobody receives the EXIT. The data channel holds the EXITs of the ping and the read
+// routines of a connection
 func (wsh *WebSocketHandler) closeConnection(conn *websocket.Conn, message string) {
 	wsh.mutex.Lock()
 	conn.Close()
 	wsh.mutex.Unlock()
-	wsh.data <- DataSocket{RType: EXIT, message: message}
+	select {
+	case wsh.data <- DataSocket{RType: EXIT, message: message, conn: conn}:
+	default:
+	}
 }
 
 func getNumericValueFromEnvVar(envVar string, defaultValue int) int {